@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// billedIssue is what was already pushed to FreshBooks for a single issue
+type billedIssue struct {
+	Seconds  int64            // total seconds billed for the issue
+	Worklogs map[string]int64 // JIRA worklog ID to seconds billed
+}
+
+// billedLedger remembers billed time per issue key so that reopened
+// issues only bill time logged since the last run
+type billedLedger struct {
+	file   string
+	Issues map[string]*billedIssue
+}
+
+// loadLedger reads ~/.j2i/billed/<client>.json, missing file is an empty ledger
+func loadLedger(client string) (*billedLedger, error) {
+	l := &billedLedger{
+		file:   filepath.Join(j2iDir(), "billed", client+".json"),
+		Issues: make(map[string]*billedIssue),
+	}
+	b, err := ioutil.ReadFile(l.file)
+	if os.IsNotExist(err) {
+		return l, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, l); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *billedLedger) save() error {
+	if c.dryRun {
+		return nil
+	}
+	b, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(l.file), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(l.file, b, 0600)
+}
+
+func (l *billedLedger) issue(key string) *billedIssue {
+	bi, ok := l.Issues[key]
+	if !ok {
+		bi = &billedIssue{Worklogs: make(map[string]int64)}
+		l.Issues[key] = bi
+	}
+	if bi.Worklogs == nil {
+		bi.Worklogs = make(map[string]int64)
+	}
+	return bi
+}
+
+// apply sets Billed seconds on allItems and their worklogs
+func (l *billedLedger) apply(allItems Items) {
+	for i, v := range allItems {
+		bi, ok := l.Issues[v.Key.Val]
+		if !ok {
+			continue
+		}
+		allItems[i].Billed = bi.Seconds
+
+		// issue was billed as a whole before worklogs were tracked,
+		// consume billed seconds from the oldest worklogs first
+		left := int64(0)
+		if len(bi.Worklogs) == 0 {
+			left = bi.Seconds
+		}
+		for n, w := range allItems[i].Worklogs {
+			if s, ok := bi.Worklogs[w.ID]; ok {
+				allItems[i].Worklogs[n].Billed = s
+				continue
+			}
+			if left > 0 {
+				s := w.Seconds
+				if s > left {
+					s = left
+				}
+				allItems[i].Worklogs[n].Billed = s
+				left -= s
+			}
+		}
+	}
+}
+
+// billedChange is what record added for a single issue, undo takes it back
+// leaving what later runs added in place
+type billedChange struct {
+	Key      string
+	Seconds  int64
+	Worklogs map[string]int64 // worklog ID to seconds added
+}
+
+// record marks Entry (every issue rolled into it) as billed and persists the ledger,
+// returns what it changed
+func (l *billedLedger) record(e Entry) ([]billedChange, error) {
+	var changes []billedChange
+	for _, p := range e.parts() {
+		if p.Seconds == 0 {
+			continue // billed before or nothing logged
+		}
+		bi := l.issue(p.Key)
+		bi.Seconds += p.Seconds
+		ch := billedChange{Key: p.Key, Seconds: p.Seconds, Worklogs: make(map[string]int64)}
+		for id, s := range p.Worklogs {
+			ch.Worklogs[id] = s - bi.Worklogs[id]
+			bi.Worklogs[id] = s
+		}
+		changes = append(changes, ch)
+	}
+	return changes, l.save()
+}
+
+// undo takes back changes of record and persists the ledger
+func (l *billedLedger) undo(changes []billedChange) error {
+	for _, ch := range changes {
+		bi, ok := l.Issues[ch.Key]
+		if !ok {
+			continue
+		}
+		bi.Seconds -= ch.Seconds
+		if bi.Seconds < 0 {
+			bi.Seconds = 0
+		}
+		for id, s := range ch.Worklogs {
+			bi.Worklogs[id] -= s
+			if bi.Worklogs[id] <= 0 {
+				delete(bi.Worklogs, id)
+			}
+		}
+		if bi.Seconds == 0 && len(bi.Worklogs) == 0 {
+			delete(l.Issues, ch.Key)
+		}
+	}
+	return l.save()
+}
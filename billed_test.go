@@ -0,0 +1,123 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func ledgerItem(key string) Item {
+	return Item{
+		Key: ItemKey{Val: key},
+		Worklogs: []ItemWorklog{
+			worklog("1", "ann", "2026-03-02", 1),
+			worklog("2", "ann", "2026-03-03", 1),
+			worklog("3", "ann", "2026-04-01", 1),
+		},
+	}
+}
+
+func TestLedgerApply(t *testing.T) {
+	tests := []struct {
+		name   string
+		billed *billedIssue
+		item   int64   // Billed of the item
+		logs   []int64 // Billed of its worklogs
+	}{
+		{"not billed", nil, 0, []int64{0, 0, 0}},
+		{"by worklog", &billedIssue{Seconds: 5400, Worklogs: map[string]int64{"1": 3600, "3": 1800}}, 5400, []int64{3600, 0, 1800}},
+		{"as a whole", &billedIssue{Seconds: 5400}, 5400, []int64{3600, 1800, 0}},
+		{"more than logged", &billedIssue{Seconds: 5 * 3600}, 5 * 3600, []int64{3600, 3600, 3600}},
+	}
+	for _, tt := range tests {
+		l := &billedLedger{Issues: make(map[string]*billedIssue)}
+		if tt.billed != nil {
+			l.Issues["ALU-1"] = tt.billed
+		}
+		allItems := Items{ledgerItem("ALU-1")}
+		l.apply(allItems)
+
+		if allItems[0].Billed != tt.item {
+			t.Errorf("%s: item billed %d, want %d", tt.name, allItems[0].Billed, tt.item)
+		}
+		var logs []int64
+		for _, w := range allItems[0].Worklogs {
+			logs = append(logs, w.Billed)
+		}
+		if !reflect.DeepEqual(logs, tt.logs) {
+			t.Errorf("%s: worklogs billed %v, want %v", tt.name, logs, tt.logs)
+		}
+	}
+}
+
+func TestLedgerRecordUndo(t *testing.T) {
+	saved := c
+	defer func() { c = saved }()
+	c = &appContext{dryRun: true} // no ledger file
+
+	tests := []struct {
+		name   string
+		before map[string]*billedIssue
+		e      Entry
+	}{
+		{"new issue", map[string]*billedIssue{}, Entry{Key: "ALU-1", Seconds: 3600, Worklogs: map[string]int64{"1": 3600}}},
+		{"more time", map[string]*billedIssue{"ALU-1": {Seconds: 1800, Worklogs: map[string]int64{"1": 1800}}},
+			Entry{Key: "ALU-1", Seconds: 3600, Billed: 1800, Worklogs: map[string]int64{"1": 3600, "2": 1800}}},
+		{"billed as a whole", map[string]*billedIssue{"ALU-1": {Seconds: 1800}}, Entry{Key: "ALU-1", Seconds: 1800}},
+		{"rolled up", map[string]*billedIssue{"ALU-2": {Seconds: 60, Worklogs: map[string]int64{"9": 60}}},
+			Entry{Key: "ALU-1", Rolled: Entries{
+				{Key: "ALU-1", Seconds: 60, Worklogs: map[string]int64{"1": 60}},
+				{Key: "ALU-2", Seconds: 60, Worklogs: map[string]int64{"2": 60}},
+			}}},
+	}
+	for _, tt := range tests {
+		l := &billedLedger{Issues: make(map[string]*billedIssue)}
+		want := make(map[string]*billedIssue)
+		for k, v := range tt.before {
+			l.issue(k).Seconds = v.Seconds
+			want[k] = &billedIssue{Seconds: v.Seconds, Worklogs: make(map[string]int64)}
+			for id, s := range v.Worklogs {
+				l.Issues[k].Worklogs[id] = s
+				want[k].Worklogs[id] = s
+			}
+		}
+
+		changes, err := l.record(tt.e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range tt.e.parts() {
+			if bi := l.Issues[p.Key]; bi == nil || bi.Seconds < p.Seconds {
+				t.Errorf("%s: %s not recorded: %+v", tt.name, p.Key, bi)
+			}
+		}
+		if err := l.undo(changes); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(l.Issues, want) {
+			t.Errorf("%s: undo left %v, want %v", tt.name, l.Issues, want)
+		}
+	}
+}
+
+// rolling back a run leaves time billed by later runs in the ledger
+func TestLedgerUndoEarlier(t *testing.T) {
+	saved := c
+	defer func() { c = saved }()
+	c = &appContext{dryRun: true}
+
+	l := &billedLedger{Issues: make(map[string]*billedIssue)}
+	a, err := l.record(Entry{Key: "ALU-1", Seconds: 3600, Worklogs: map[string]int64{"1": 3600}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.record(Entry{Key: "ALU-1", Seconds: 3600, Billed: 3600, Worklogs: map[string]int64{"1": 7200}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.undo(a); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]*billedIssue{"ALU-1": {Seconds: 3600, Worklogs: map[string]int64{"1": 3600}}}
+	if !reflect.DeepEqual(l.Issues, want) {
+		t.Errorf("undo left %v, want %v", l.Issues["ALU-1"], want["ALU-1"])
+	}
+}
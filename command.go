@@ -0,0 +1,79 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: j2i [flags] [command]\n\n")
+	fmt.Fprintf(os.Stderr, "Without a command j2i bills -client: JIRA report, FreshBooks push and JIRA update\n\n")
+	fmt.Fprintf(os.Stderr, "Commands:\n")
+	fmt.Fprintf(os.Stderr, "  authorize jira          OAuth 2.0 authorization of j2i on JIRA Cloud site of -client (or JiraAccountName)\n")
+	fmt.Fprintf(os.Stderr, "  authorize freshbooks    OAuth authorization of j2i on FreshBooks (OAuth 2.0 with FbAPI: rest)\n")
+	fmt.Fprintf(os.Stderr, "  provision               create FreshBooks client, project and tasks of -client missing in FreshBooks\n")
+	fmt.Fprintf(os.Stderr, "  reconcile [fix]         compare FreshBooks time entries of -client's project with JIRA over the period,\n")
+	fmt.Fprintf(os.Stderr, "                          fix makes FreshBooks match billed time once confirmed (j2i rollback undoes it)\n")
+	fmt.Fprintf(os.Stderr, "  resume [RUN-ID]         finish failed billing run (the latest one of -client) where it stopped,\n")
+	fmt.Fprintf(os.Stderr, "                          runs are journaled under ~/.j2i/runs\n")
+	fmt.Fprintf(os.Stderr, "  rollback RUN-ID|INVOICE undo billing run: delete its time entries, unlabel its issues and move them\n")
+	fmt.Fprintf(os.Stderr, "                          back to ReverseStatus (or with ReverseTransID), or undo reconcile fix\n")
+	fmt.Fprintf(os.Stderr, "\nFlags:\n")
+	flag.PrintDefaults()
+	fmt.Fprintf(os.Stderr, "\nExit codes:\n")
+	fmt.Fprintf(os.Stderr, "  %d  done\n", exitOK)
+	fmt.Fprintf(os.Stderr, "  %d  failed - the run stopped (j2i resume) or was rolled back (-onFailure rollback)\n", exitFailed)
+	fmt.Fprintf(os.Stderr, "  %d  bad flags or command\n", exitUsage)
+	fmt.Fprintf(os.Stderr, "  %d  a confirmation was declined or skipped (stdin is not a terminal) - j2i -yes resume\n", exitDeclined)
+	fmt.Fprintf(os.Stderr, "  %d  done except for failed time entries or issues (-onFailure continue) or issues\n"+
+		"     that can't be transitioned - j2i resume\n", exitPartial)
+}
+
+// runCommand runs command given after the flags, false means there was none
+func (c *appContext) runCommand(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+
+	var err error
+	switch args[0] {
+	case "authorize":
+		err = c.authorize(args[1:])
+	case "provision":
+		err = c.provision()
+	case "reconcile":
+		err = c.reconcile(args[1:])
+	case "rollback":
+		err = c.rollback(args[1:])
+	default:
+		err = usageError("unknown command: " + args[0])
+	}
+	if _, ok := err.(usageError); ok {
+		fmt.Fprintf(os.Stderr, "j2i: %v\n", err)
+		os.Exit(exitUsage)
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "j2i: %v\n", err)
+		os.Exit(exitFailed)
+	}
+	if c.exit != exitOK {
+		os.Exit(c.exit)
+	}
+	return true
+}
+
+func (c *appContext) authorize(args []string) error {
+	if len(args) != 1 {
+		return usageError("usage: j2i [-client CODE] authorize jira|freshbooks")
+	}
+	switch args[0] {
+	case "jira":
+		return c.authorizeJira()
+	case "freshbooks":
+		if c.cfg.FbAPI == fbREST {
+			return c.authorizeFreshBooks()
+		}
+		return c.authorizeFreshBooksClassic()
+	}
+	return usageError("can't authorize " + args[0])
+}
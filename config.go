@@ -0,0 +1,244 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"os/user"
+	"path/filepath"
+)
+
+type appConfig struct {
+	JiraAccountName     string                   // Account name (i.e. hashjoin - appended to .atlassian.net XML feed for items)
+	JiraBaseURL         string                   // Base URL of JIRA Server / Data Center incl. context path (i.e. https://jira.example.com/jira), overrides JiraAccountName
+	JiraUname           string                   // Username (i.e. admin, not email address)
+	JiraPass            string                   // Password
+	JiraToken           string                   // Personal access token (JIRA Server / Data Center), used instead of JiraUname/JiraPass
+	JiraEmail           string                   // Account email (JIRA Cloud), used with JiraAPIToken instead of JiraUname/JiraPass
+	JiraAPIToken        string                   // API token (JIRA Cloud) from id.atlassian.com
+	JiraOAuthClientID   string                   // OAuth 2.0 (3LO) app on developer.atlassian.com, when set j2i authorize jira
+	JiraOAuthSecret     string                   // stores tokens under ~/.j2i/oauth that are used instead of other credentials
+	JiraOAuthRedirect   string                   // OAuth 2.0 app callback URL
+	JiraInvoicedTransID string                   // Transition ID set on invoiced issues (for example Done=11 on our JIRA Cloud Instance)
+	JiraInvoicedStatus  string                   // Status invoiced issues are moved to (for example Done), used instead of JiraInvoicedTransID - the transition is looked up per issue
+	JiraInvoicedPrefix  string                   // Invoiced issues are labled with JiraInvoicedPrefix+FB-Invoice#
+	JiraReverseTransID  string                   // Transition ID j2i rollback moves invoiced issues back with (for example Reopen)
+	JiraReverseStatus   string                   // Status j2i rollback moves invoiced issues back to (for example In Progress), used instead of JiraReverseTransID
+	ClientSearchIDs     map[string]string        // Client Code to JIRA Search Filter ID mapping (deprecated - see Clients)
+	Clients             map[string]*clientConfig // Client Code to per client settings
+	Period              string                   // Default billing period: thisMonth or lastMonth
+	From                string                   // Default billing period start YYYY-MM-DD
+	To                  string                   // Default billing period end YYYY-MM-DD
+	DateSources         []string                 // Where issue date comes from, in order: due, resolved, worklog, updated, run
+	JiraEpicField       string                   // Epic Link custom field (default customfield_10014)
+	FbAPI               string                   // FreshBooks API: classic (XML, default) or rest (JSON with OAuth 2.0)
+	FbAccountName       string
+	FbAuthToken         string            // Token-Based authentication (deprecated)
+	FbConsumerKey       string            // OAuth authentication
+	FbConsumerSecret    string            // OAuth authentication
+	FbOAuthToken        string            // OAuth authentication
+	FbOAuthTokenSecret  string            // OAuth authentication
+	FbClientID          string            // REST API OAuth 2.0 app, j2i authorize freshbooks
+	FbClientSecret      string            // stores its tokens under ~/.j2i/oauth
+	FbRedirect          string            // REST API OAuth 2.0 app redirect URI
+	FbBusinessID        int               // REST API business (default the first one of the authorized user)
+	FbStaff             map[string]string // JIRA worklog author email (or name) to FreshBooks staff email, "*" - time with no author
+}
+
+// clientConfig is everything j2i needs to bill a single client,
+// command line flags override it and it overrides global settings
+type clientConfig struct {
+	JiraBaseURL    string             // JIRA instance of the client (default JiraBaseURL or JiraAccountName)
+	JiraUname      string             // Username on the client instance (default JiraUname)
+	JiraPass       string             // Password on the client instance (default JiraPass)
+	JiraToken      string             // Personal access token on the client instance (default JiraToken)
+	JiraEmail      string             // Account email on the client instance (default JiraEmail)
+	JiraAPIToken   string             // API token on the client instance (default JiraAPIToken)
+	SearchID       string             // JIRA Search Filter ID
+	JQL            string             // JIRA query, used instead of SearchID when set
+	FbClient       string             // FreshBooks Client Name, needed when FbProject name is used by several clients
+	FbProject      string             // FreshBooks Project Name
+	FbProjectStaff []string           // FreshBooks staff emails j2i provision assigns to FbProject
+	FbTaskRates    map[string]float64 // FreshBooks Task to rate for tasks j2i provision creates
+	FbTask         string             // FreshBooks Task (default task when Tasks rules are set)
+	Tasks          []taskRule         // Issue type, label, component or custom field to FreshBooks Task, the first matching rule wins
+	TransID        string             // Transition ID set on invoiced issues (default JiraInvoicedTransID)
+	InvoicedStatus string             // Status invoiced issues are moved to, used instead of TransID (default JiraInvoicedStatus)
+	ReverseTransID string             // Transition ID of j2i rollback (default JiraReverseTransID)
+	ReverseStatus  string             // Status j2i rollback moves issues back to, used instead of ReverseTransID (default JiraReverseStatus)
+	InvoicedPrefix string             // Invoiced issues label prefix (default JiraInvoicedPrefix)
+	Entries        string             // Time entry per: issue, worklog or day
+	Period         string             // Billing period: thisMonth or lastMonth
+	From           string             // Billing period start YYYY-MM-DD
+	To             string             // Billing period end YYYY-MM-DD
+	DateSources    []string           // Where issue date comes from (default DateSources)
+	Rollup         string             // Sub-task / epic rollup: none, parent or epic
+	Rounding       rounding           // Rounding of every time entry
+	PDFDir         string             // Invoice PDFs are saved here (default ~/Desktop)
+	SendInvoice    bool               // Email the invoice to the client at the end of the run (see -send)
+	InvoiceSubject string             // Invoice email subject template: {{.Number}}, {{.Client}}, {{.Date}}, {{.Amount}}, {{.Period}}
+	InvoiceMessage string             // Invoice email message template, same fields as InvoiceSubject
+	ReportDir      string             // When set the report is also saved here
+
+	jiraOAuth bool // JIRA is accessed with tokens of j2i authorize jira
+}
+
+// rounding rules applied to every time entry pushed to FreshBooks
+type rounding struct {
+	Increment int    // Minutes, entries are rounded to a multiple of Increment (0 - no rounding)
+	Mode      string // up (default), down or nearest
+	Minimum   int    // Minutes, shorter entries are billed as Minimum
+}
+
+// j2iDir returns path of the ~/.j2i directory holding config and state
+func j2iDir() string {
+	usr, err := user.Current()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "j2i: %v\n", err)
+		os.Exit(1)
+	}
+	return filepath.Join(usr.HomeDir, ".j2i")
+}
+
+// homeDir returns path to dir inside user's home directory
+func homeDir(dir string) string {
+	return filepath.Join(filepath.Dir(j2iDir()), dir)
+}
+
+// loadConfig loads ~/.j2i/config.json, with allowMissing
+// an empty config is returned when there is no config file
+func loadConfig(allowMissing bool) *appConfig {
+	cfgFile := filepath.Join(j2iDir(), "config.json")
+	file, e := ioutil.ReadFile(cfgFile)
+	if os.IsNotExist(e) && allowMissing {
+		return &appConfig{}
+	}
+	if e != nil {
+		fmt.Fprintf(os.Stderr, "Unable to load %s", cfgFile)
+		os.Exit(1)
+	}
+	var config appConfig
+	if err := json.Unmarshal(file, &config); err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to unmarshal %s", cfgFile)
+		os.Exit(1)
+	}
+	return &config
+}
+
+// saveConfig sets fields of ~/.j2i/config.json leaving the rest of it as is
+// and returns path of the file
+func saveConfig(fields map[string]interface{}) (string, error) {
+	cfgFile := filepath.Join(j2iDir(), "config.json")
+	config := make(map[string]interface{})
+	file, err := ioutil.ReadFile(cfgFile)
+	if err != nil {
+		return "", err
+	}
+	if err := json.Unmarshal(file, &config); err != nil {
+		return "", err
+	}
+	for k, v := range fields {
+		config[k] = v
+	}
+	b, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return cfgFile, ioutil.WriteFile(cfgFile, append(b, '\n'), 0600)
+}
+
+// clientConfig returns settings of client code with global defaults filled in,
+// clients only listed in ClientSearchIDs get just their Search Filter ID
+func (cfg *appConfig) clientConfig(code string) *clientConfig {
+	var cc clientConfig
+	if cl, ok := cfg.Clients[code]; ok && cl != nil {
+		cc = *cl
+	} else if id, ok := cfg.ClientSearchIDs[code]; ok {
+		cc.SearchID = id
+	}
+	var cloudURL string
+	if cfg.JiraAccountName != "" {
+		cloudURL = fmt.Sprintf("https://%s.atlassian.net", cfg.JiraAccountName)
+	}
+	cc.JiraBaseURL = firstSet(cc.JiraBaseURL, cfg.JiraBaseURL, cloudURL)
+
+	// client credentials are all or nothing
+	if cc.JiraUname == "" && cc.JiraPass == "" && cc.JiraToken == "" && cc.JiraEmail == "" && cc.JiraAPIToken == "" {
+		cc.JiraUname, cc.JiraPass, cc.JiraToken = cfg.JiraUname, cfg.JiraPass, cfg.JiraToken
+		cc.JiraEmail, cc.JiraAPIToken = cfg.JiraEmail, cfg.JiraAPIToken
+		cc.jiraOAuth = cfg.JiraOAuthClientID != ""
+	}
+	// client's own transition wins over the global one, status over ID
+	if cc.InvoicedStatus == "" && cc.TransID == "" {
+		cc.InvoicedStatus, cc.TransID = cfg.JiraInvoicedStatus, cfg.JiraInvoicedTransID
+	}
+	if cc.ReverseStatus == "" && cc.ReverseTransID == "" {
+		cc.ReverseStatus, cc.ReverseTransID = cfg.JiraReverseStatus, cfg.JiraReverseTransID
+	}
+	cc.InvoicedPrefix = firstSet(cc.InvoicedPrefix, cfg.JiraInvoicedPrefix)
+	cc.Entries = firstSet(cc.Entries, entryDay)
+	cc.Rollup = firstSet(cc.Rollup, rollupNone)
+	cc.Period = firstSet(cc.Period, cfg.Period)
+	cc.From = firstSet(cc.From, cfg.From)
+	cc.To = firstSet(cc.To, cfg.To)
+	cc.PDFDir = firstSet(cc.PDFDir, homeDir("Desktop"))
+	if len(cc.DateSources) == 0 {
+		cc.DateSources = cfg.DateSources
+	}
+	if len(cc.DateSources) == 0 {
+		cc.DateSources = defaultDateSources
+	}
+	return &cc
+}
+
+// epicField returns Epic Link custom field ID
+func (cfg *appConfig) epicField() string {
+	return firstSet(cfg.JiraEpicField, "customfield_10014")
+}
+
+// jql returns JIRA query selecting client's issues
+func (cc *clientConfig) jql() (string, error) {
+	switch {
+	case cc.JQL != "":
+		return cc.JQL, nil
+	case cc.SearchID != "":
+		return "filter=" + cc.SearchID, nil
+	}
+	return "", fmt.Errorf("neither JQL nor SearchID is configured for the client")
+}
+
+// firstSet returns first non empty value - flag, client config, global config ...
+func firstSet(vals ...string) string {
+	for _, v := range vals {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// apply rounds seconds according to the rules, zero stays zero
+func (r rounding) apply(seconds int64) int64 {
+	if seconds <= 0 {
+		return seconds
+	}
+	if r.Increment > 0 {
+		inc := float64(r.Increment * 60)
+		units := float64(seconds) / inc
+		switch r.Mode {
+		case "down":
+			units = math.Floor(units)
+		case "nearest":
+			units = math.Floor(units + 0.5)
+		default:
+			units = math.Ceil(units)
+		}
+		seconds = int64(units * inc)
+	}
+	if min := int64(r.Minimum * 60); seconds < min {
+		seconds = min
+	}
+	return seconds
+}
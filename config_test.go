@@ -0,0 +1,57 @@
+package main
+
+import "testing"
+
+func TestRoundingApply(t *testing.T) {
+	tests := []struct {
+		r       rounding
+		seconds int64
+		want    int64
+	}{
+		{rounding{}, 1234, 1234},
+		{rounding{Increment: 15}, 0, 0},
+		{rounding{Increment: 15}, 60, 900},
+		{rounding{Increment: 15}, 900, 900},
+		{rounding{Increment: 15}, 901, 1800},
+		{rounding{Increment: 15, Mode: "down"}, 1799, 900},
+		{rounding{Increment: 15, Mode: "down"}, 60, 0},
+		{rounding{Increment: 15, Mode: "nearest"}, 1349, 900},
+		{rounding{Increment: 15, Mode: "nearest"}, 1350, 1800},
+		{rounding{Minimum: 30}, 60, 1800},
+		{rounding{Minimum: 30}, 3600, 3600},
+		{rounding{Increment: 15, Mode: "down", Minimum: 15}, 60, 900},
+	}
+	for _, tt := range tests {
+		if got := tt.r.apply(tt.seconds); got != tt.want {
+			t.Errorf("%+v of %d: %d, want %d", tt.r, tt.seconds, got, tt.want)
+		}
+	}
+}
+
+// rounded time goes to FreshBooks, the ledger keeps time as logged so that
+// the next run has nothing left to bill
+func TestRoundingLedger(t *testing.T) {
+	saved := c
+	defer func() { c = saved }()
+	c = &appContext{dryRun: true}
+
+	r := rounding{Increment: 15, Mode: "down", Minimum: 15}
+	item := Item{Key: ItemKey{Val: "ALU-1"}}
+	item.TimeSpent.Seconds = 50 * 60
+	l := &billedLedger{Issues: make(map[string]*billedIssue)}
+
+	for run, want := range []float64{0.75, 0} {
+		allItems := Items{item}
+		l.apply(allItems)
+		e := buildEntries(allItems, entryIssue)[0]
+		e.Rounded = r.apply(e.Seconds)
+		if e.Hours() != want {
+			t.Errorf("run %d: %.2f hours, want %.2f", run+1, e.Hours(), want)
+		}
+		if !e.done() {
+			if _, err := l.record(e); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
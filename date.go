@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Date sources - where the billing date of an issue comes from
+const (
+	dateDue      = "due"      // issue due date
+	dateResolved = "resolved" // issue resolution date
+	dateWorklog  = "worklog"  // date of the last worklog
+	dateUpdated  = "updated"  // issue last update
+	dateRun      = "run"      // date j2i runs on
+)
+
+// defaultDateSources are tried in order until one of them has a date
+var defaultDateSources = []string{dateDue, dateResolved, dateWorklog, dateUpdated, dateRun}
+
+// dateLayouts are date formats used by RSS feed and by REST API fields
+var dateLayouts = []string{
+	"Mon, 2 Jan 2006 15:04:05 -0700", // Mon, 4 Apr 2016 00:00:00 -0700
+	"2006-01-02T15:04:05.000-0700",   // 2016-04-04T10:21:31.000-0700
+	"2006-01-02",                     // 2016-04-04
+}
+
+// parseDate parses date as found in RSS feed or in REST API fields
+func parseDate(val string) (time.Time, error) {
+	var err error
+	for _, layout := range dateLayouts {
+		var t time.Time
+		if t, err = time.Parse(layout, val); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, err
+}
+
+func validDateSources(sources []string) error {
+	for _, src := range sources {
+		switch src {
+		case dateDue, dateResolved, dateWorklog, dateUpdated, dateRun:
+		default:
+			return fmt.Errorf("unknown date source: %s", src)
+		}
+	}
+	return nil
+}
+
+// itemDate returns date of the first source in sources that v has,
+// run date is the last resort when none of them does
+func itemDate(v Item, sources []string, run time.Time) (time.Time, string) {
+	for _, src := range sources {
+		var val string
+		switch src {
+		case dateDue:
+			val = v.Due
+		case dateResolved:
+			val = v.Resolved
+		case dateUpdated:
+			val = v.Updated
+		case dateWorklog:
+			var last time.Time
+			for _, w := range v.Worklogs {
+				if w.Started.After(last) {
+					last = w.Started
+				}
+			}
+			if !last.IsZero() {
+				return last, src
+			}
+			continue
+		case dateRun:
+			return run, src
+		}
+
+		if val == "" {
+			continue
+		}
+		if t, err := parseDate(val); err == nil {
+			return t, src
+		} else if c.trace {
+			fmt.Printf("%s: %s %q: %v\n", v.Key.Val, src, val, err)
+		}
+	}
+	return run, dateRun
+}
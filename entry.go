@@ -0,0 +1,203 @@
+package main
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Entry modes - how JIRA time is split into FreshBooks time entries
+const (
+	entryIssue   = "issue"   // one entry per issue dated by its date sources (due date ...)
+	entryWorklog = "worklog" // one entry per individual worklog
+	entryDay     = "day"     // one entry per issue, author and day worklogs were logged on
+)
+
+// Entry is a single billable line - it becomes one FreshBooks TimeEntry
+type Entry struct {
+	Key      string
+	Summary  string
+	Date     time.Time
+	DateSrc  string // date source Date came from
+	Author   string
+	Email    string
+	Task     string // FreshBooks task
+	Seconds  int64  // unbilled seconds as logged - recorded in billed ledger
+	Rounded  int64  // Seconds rounded by client's Rounding - pushed to FreshBooks
+	Billed   int64  // seconds billed on previous runs
+	Comments []string
+	Worklogs map[string]int64 // JIRA worklog ID to its seconds rolled into this Entry
+	Subtasks []string         // sub-task keys rolled into this Entry
+	Epic     ItemLink         // set by epic rollup
+	Rolled   Entries          // entries of individual issues merged into this one
+}
+
+// Entries are collection of Entry
+type Entries []Entry
+
+// Hours returns rounded unbilled time of Entry in hours
+func (e Entry) Hours() float64 {
+	return float64(e.Rounded) / 60 / 60
+}
+
+// BilledHours returns previously billed time of Entry in hours
+func (e Entry) BilledHours() float64 {
+	return float64(e.Billed) / 60 / 60
+}
+
+// done is true when Entry has nothing left to bill - everything in it was
+// billed on previous runs, no time was logged at all or it rounds to none
+func (e Entry) done() bool {
+	return e.Rounded == 0
+}
+
+// unbilled returns seconds not yet billed, edits that lowered
+// already billed time never produce negative entries
+func unbilled(total, billed int64) int64 {
+	if total < billed {
+		return 0
+	}
+	return total - billed
+}
+
+// parts returns entries of individual issues Entry was made of
+func (e Entry) parts() Entries {
+	if len(e.Rolled) > 0 {
+		return e.Rolled
+	}
+	return Entries{e}
+}
+
+// Notes returns FreshBooks time entry notes for Entry
+func (e Entry) Notes() string {
+	return e.description() + " " + e.marker()
+}
+
+// description is Notes without the marker
+func (e Entry) description() string {
+	notes := fmt.Sprintf("%s: %s", e.Key, e.Summary)
+	if len(e.Subtasks) > 0 {
+		notes += " (" + strings.Join(e.Subtasks, ", ") + ")"
+	}
+	if e.Epic.Key != "" {
+		notes = fmt.Sprintf("[%s: %s] %s", e.Epic.Key, e.Epic.Summary, notes)
+	}
+	if len(e.Comments) > 0 {
+		notes += " - " + strings.Join(e.Comments, "; ")
+	}
+	return notes
+}
+
+// markerRe finds marker in FreshBooks time entry notes
+var markerRe = regexp.MustCompile(`\[j2i:[^\]]+\]`)
+
+// clientNotes returns notes without the marker, the way the client gets to see them
+func clientNotes(notes string) string {
+	return strings.TrimSpace(markerRe.ReplaceAllString(notes, ""))
+}
+
+// marker identifies time pushed for Entry: its issues, what of them was billed
+// before and their worklogs - pushing the same Entry again yields the same marker
+func (e Entry) marker() string {
+	return e.markerOf("")
+}
+
+// restoredMarker identifies billed time of Entry put back by reconcile fix,
+// it never matches marker of the time pushed for Entry later
+func (e Entry) restoredMarker() string {
+	return e.markerOf("restored;")
+}
+
+func (e Entry) markerOf(tag string) string {
+	h := sha1.New()
+	fmt.Fprint(h, tag)
+	parts := append(Entries(nil), e.parts()...)
+	sort.Slice(parts, func(i, j int) bool { return parts[i].Key < parts[j].Key })
+	for _, p := range parts {
+		ids := make([]string, 0, len(p.Worklogs))
+		for id := range p.Worklogs {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		fmt.Fprintf(h, "%s@%d/%s;", p.Key, p.Billed, strings.Join(ids, ","))
+	}
+	return fmt.Sprintf("[j2i:%s:%x]", e.Key, h.Sum(nil)[:4])
+}
+
+func validEntryMode(mode string) bool {
+	switch mode {
+	case entryIssue, entryWorklog, entryDay:
+		return true
+	}
+	return false
+}
+
+// buildEntries splits Items into Entries according to mode,
+// Items without worklogs fall back to a single issue level Entry
+func buildEntries(allItems Items, mode string) Entries {
+	var all Entries
+	for _, v := range allItems {
+		if len(v.Worklogs) == 0 {
+			all = append(all, Entry{
+				Key:     v.Key.Val,
+				Summary: v.Summary,
+				Date:    v.Date,
+				DateSrc: v.DateSrc,
+				Task:    v.Task,
+				Seconds: unbilled(v.TimeSpent.Seconds, v.Billed),
+				Billed:  v.Billed,
+			})
+			continue
+		}
+
+		groups := make(map[string]int)
+		for _, w := range v.Worklogs {
+			var group string
+			switch mode {
+			case entryWorklog:
+				group = w.ID
+			case entryDay:
+				group = w.Author + "/" + w.Started.Format(dayFormat)
+			}
+
+			n, ok := groups[group]
+			if !ok {
+				e := Entry{
+					Key:      v.Key.Val,
+					Summary:  v.Summary,
+					Date:     w.Started,
+					DateSrc:  dateWorklog,
+					Author:   w.Author,
+					Email:    w.Email,
+					Task:     v.Task,
+					Worklogs: make(map[string]int64),
+				}
+				if mode == entryIssue {
+					e.Date, e.DateSrc, e.Author, e.Email = v.Date, v.DateSrc, "", ""
+				}
+				n = len(all)
+				groups[group] = n
+				all = append(all, e)
+			}
+
+			all[n].Seconds += unbilled(w.Seconds, w.Billed)
+			all[n].Billed += w.Billed
+			all[n].Worklogs[w.ID] = w.Seconds
+			if mode != entryIssue && w.Comment != "" && w.Seconds > w.Billed {
+				all[n].Comments = append(all[n].Comments, w.Comment)
+			}
+		}
+	}
+
+	for i := range all {
+		all[i].Rounded = all[i].Seconds
+	}
+	// keep the report and FreshBooks chronological
+	sort.SliceStable(all, func(i, j int) bool {
+		return all[i].Date.Format(dayFormat) < all[j].Date.Format(dayFormat)
+	})
+	return all
+}
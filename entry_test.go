@@ -0,0 +1,164 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// day parses YYYY-MM-DD, hours after it go on top
+func day(s string, hours ...int) time.Time {
+	t, err := time.Parse(dayFormat, s)
+	if err != nil {
+		panic(err)
+	}
+	for _, h := range hours {
+		t = t.Add(time.Duration(h) * time.Hour)
+	}
+	return t
+}
+
+func worklog(id, author, started string, hours float64) ItemWorklog {
+	return ItemWorklog{ID: id, Author: author, Started: day(started, 9), Seconds: int64(hours * 3600)}
+}
+
+func TestBuildEntriesFeed(t *testing.T) {
+	allItems, err := readItems("testdata/ALU.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	allEntries := buildEntries(allItems, entryIssue)
+	if len(allEntries) != len(allItems) {
+		t.Fatalf("%d entries of %d items", len(allEntries), len(allItems))
+	}
+	var hours float64
+	for _, e := range allEntries {
+		hours += e.Hours()
+	}
+	if hours != 9 {
+		t.Errorf("entries hold %.2f hours, want 9.00", hours)
+	}
+}
+
+func TestBuildEntries(t *testing.T) {
+	item := Item{
+		Key:     ItemKey{Val: "ALU-1"},
+		Summary: "research",
+		Date:    day("2026-04-30"),
+		Worklogs: []ItemWorklog{
+			worklog("1", "ann", "2026-04-02", 1),
+			worklog("2", "bob", "2026-04-02", 2),
+			worklog("3", "ann", "2026-04-02", 0.5),
+			worklog("4", "ann", "2026-04-03", 1),
+		},
+	}
+	item.Worklogs[0].Billed = 3600
+
+	tests := []struct {
+		mode    string
+		entries int
+		unbill  int64 // unbilled seconds of the first entry
+		billed  int64 // billed seconds of the first entry
+		date    string
+	}{
+		{entryIssue, 1, 4.5*3600 - 3600, 3600, "2026-04-30"},
+		{entryWorklog, 4, 0, 3600, "2026-04-02"},
+		{entryDay, 3, 0.5 * 3600, 3600, "2026-04-02"},
+	}
+	for _, tt := range tests {
+		allEntries := buildEntries(Items{item}, tt.mode)
+		if len(allEntries) != tt.entries {
+			t.Errorf("%s: %d entries, want %d", tt.mode, len(allEntries), tt.entries)
+			continue
+		}
+		e := allEntries[0]
+		if e.Seconds != tt.unbill || e.Billed != tt.billed {
+			t.Errorf("%s: unbilled %d billed %d, want %d and %d", tt.mode, e.Seconds, e.Billed, tt.unbill, tt.billed)
+		}
+		if got := e.Date.Format(dayFormat); got != tt.date {
+			t.Errorf("%s: dated %s, want %s", tt.mode, got, tt.date)
+		}
+	}
+}
+
+func TestBuildEntriesWithoutWorklogs(t *testing.T) {
+	item := Item{Key: ItemKey{Val: "ALU-2"}, Date: day("2026-04-01"), Billed: 3600}
+	item.TimeSpent.Seconds = 7200
+	for _, mode := range []string{entryIssue, entryWorklog, entryDay} {
+		allEntries := buildEntries(Items{item}, mode)
+		if len(allEntries) != 1 || allEntries[0].Seconds != 3600 || allEntries[0].Billed != 3600 {
+			t.Errorf("%s: %+v, want a single entry with 3600 seconds unbilled", mode, allEntries)
+		}
+	}
+}
+
+func TestMarker(t *testing.T) {
+	base := Entry{Key: "ALU-1", Summary: "research", Billed: 3600, Worklogs: map[string]int64{"1": 3600, "2": 1800}}
+	m := base.marker()
+	if !markerRe.MatchString(m) || !strings.HasPrefix(m, "[j2i:ALU-1:") {
+		t.Fatalf("bad marker %s", m)
+	}
+
+	tests := []struct {
+		name string
+		e    Entry
+		same bool
+	}{
+		{"other summary and time", Entry{Key: "ALU-1", Summary: "x", Seconds: 60, Billed: 3600, Worklogs: map[string]int64{"2": 1, "1": 1}}, true},
+		{"billed more", Entry{Key: "ALU-1", Billed: 7200, Worklogs: base.Worklogs}, false},
+		{"other worklogs", Entry{Key: "ALU-1", Billed: 3600, Worklogs: map[string]int64{"1": 3600}}, false},
+		{"other issue", Entry{Key: "ALU-2", Billed: 3600, Worklogs: base.Worklogs}, false},
+	}
+	for _, tt := range tests {
+		if same := tt.e.marker() == m; same != tt.same {
+			t.Errorf("%s: same marker %v, want %v", tt.name, same, tt.same)
+		}
+	}
+
+	// rolled up entries don't depend on the order of their parts
+	a, b := Entry{Key: "ALU-2"}, Entry{Key: "ALU-3", Billed: 60}
+	ab := Entry{Key: "ALU-1", Rolled: Entries{a, b}}
+	ba := Entry{Key: "ALU-1", Rolled: Entries{b, a}}
+	if ab.marker() != ba.marker() {
+		t.Errorf("rolled up marker depends on the order of parts")
+	}
+	if ab.Rolled[0].Key != "ALU-2" {
+		t.Errorf("marker reordered Rolled")
+	}
+}
+
+func TestClientNotes(t *testing.T) {
+	e := Entry{Key: "ALU-1", Summary: "research", Comments: []string{"SSL"}}
+	tests := []struct {
+		notes, want string
+	}{
+		{e.Notes(), "ALU-1: research - SSL"},
+		{"ALU-1: research", "ALU-1: research"},
+		{"[j2i:ALU-1:0badf00d] ALU-1: research", "ALU-1: research"},
+	}
+	for _, tt := range tests {
+		if got := clientNotes(tt.notes); got != tt.want {
+			t.Errorf("%q: %q, want %q", tt.notes, got, tt.want)
+		}
+	}
+}
+
+func TestPendingZeroTime(t *testing.T) {
+	allItems, err := readItems("testdata/ALU.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	all := buildEntries(allItems, entryIssue)
+	pending := all.pending()
+	if len(pending) != len(all)-1 {
+		t.Errorf("%d of %d entries pending, want all but ALU-6", len(pending), len(all))
+	}
+	for _, e := range pending {
+		if e.Key == "ALU-6" {
+			t.Errorf("ALU-6 with no time logged is pending")
+		}
+	}
+	if none := (Entries{{Key: "ALU-6"}}).pending(); len(none) != 0 {
+		t.Errorf("%+v pending", none)
+	}
+}
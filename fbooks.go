@@ -2,23 +2,72 @@ package main
 
 import (
 	"bytes"
-	"encoding/xml"
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"os"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
 )
 
-func (a *API) findProject(name string) int {
-	for _, v := range a.projects {
-		if v.Name == name {
-			return v.ProjectID
+// fbooks is FreshBooks as j2i sees it: a backend (classic XML API
+// or REST API) and clients, projects, tasks and users loaded from it
+type fbooks struct {
+	Books
+	staff    map[string]string // FbStaff
+	owner    int               // user time with no author goes to when FbStaff has no "*"
+	users    []User
+	tasks    []Task
+	clients  []Client
+	projects []Project
+}
+
+// newBooks returns FreshBooks backend selected by FbAPI
+func (c *appContext) newBooks() *fbooks {
+	if c.cfg.FbAPI == fbREST {
+		rest, err := c.newRestAPI()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "j2i: %v\n", err)
+			os.Exit(1)
 		}
+		// no identity - time is logged as the authorized user
+		return &fbooks{Books: rest, staff: c.cfg.FbStaff}
 	}
-	return 0
+	return &fbooks{Books: NewAPI(c.cfg.FbAccountName, c.cfg.fbToken()), staff: c.cfg.FbStaff, owner: 1}
+}
+
+// Clients - loads clients
+func (a *fbooks) Clients() ([]Client, error) {
+	var err error
+	a.clients, err = a.Books.Clients()
+	return a.clients, err
+}
+
+// Projects - loads projects
+func (a *fbooks) Projects() ([]Project, error) {
+	var err error
+	a.projects, err = a.Books.Projects()
+	return a.projects, err
+}
+
+// Tasks - loads tasks
+func (a *fbooks) Tasks() ([]Task, error) {
+	var err error
+	a.tasks, err = a.Books.Tasks()
+	return a.tasks, err
+}
+
+// Users - loads users
+func (a *fbooks) Users() ([]User, error) {
+	var err error
+	a.users, err = a.Books.Users()
+	return a.users, err
 }
 
-func (a *API) findTaskRate(name string) float64 {
+func (a *fbooks) findTaskRate(name string) float64 {
 	for _, v := range a.tasks {
 		if v.Name == name {
 			return v.Rate
@@ -27,16 +76,162 @@ func (a *API) findTaskRate(name string) float64 {
 	return 0
 }
 
-func (a *API) findTask(name string) int {
+func (a *fbooks) findClient(id int) string {
+	for _, v := range a.clients {
+		if v.ClientID == id {
+			return v.Name
+		}
+	}
+	return fmt.Sprintf("client ID %d", id)
+}
+
+// resolveProject looks up project fbProject (of client fbClient when set),
+// unknown or ambiguous names fail with suggestions
+func (a *fbooks) resolveProject(fbClient, fbProject string) (Project, error) {
+	var projects []Project
+	var names []string
+	for _, v := range a.projects {
+		if fbClient != "" && a.findClient(v.ClientID) != fbClient {
+			continue
+		}
+		names = append(names, v.Name)
+		if v.Name == fbProject {
+			projects = append(projects, v)
+		}
+	}
+	switch len(projects) {
+	case 0:
+		return Project{}, notFound("project", fbProject, names)
+	case 1:
+		return projects[0], nil
+	}
+	var clients []string
+	for _, v := range projects {
+		clients = append(clients, a.findClient(v.ClientID))
+	}
+	return Project{}, fmt.Errorf("project %q is ambiguous, it belongs to clients: %s - set FbClient", fbProject, strings.Join(clients, ", "))
+}
+
+// resolveTasks looks up tasks by their names and checks they are assigned to project
+func (a *fbooks) resolveTasks(project Project, fbTasks []string) (map[string]Task, error) {
+	tasks := make(map[string]Task)
+	for _, name := range fbTasks {
+		task, err := a.resolveTask(project, name)
+		if err != nil {
+			return nil, err
+		}
+		tasks[name] = task
+	}
+	return tasks, nil
+}
+
+// resolveTask looks up task fbTask assigned to project,
+// unknown or ambiguous names fail with suggestions
+func (a *fbooks) resolveTask(project Project, fbTask string) (Task, error) {
+	var tasks []Task
+	var names []string
 	for _, v := range a.tasks {
-		if v.Name == name {
-			return v.TaskID
+		names = append(names, v.Name)
+		if v.Name == fbTask {
+			tasks = append(tasks, v)
+		}
+	}
+	switch len(tasks) {
+	case 0:
+		return Task{}, notFound("task", fbTask, names)
+	case 1:
+	default:
+		return Task{}, fmt.Errorf("task %q is ambiguous, there are %d tasks named so", fbTask, len(tasks))
+	}
+	task := tasks[0]
+
+	for _, id := range project.TaskIDs {
+		if id == task.TaskID {
+			return task, nil
+		}
+	}
+	names = nil
+	for _, v := range a.tasks {
+		for _, id := range project.TaskIDs {
+			if id == v.TaskID {
+				names = append(names, v.Name)
+			}
+		}
+	}
+	return Task{}, fmt.Errorf("task %q is not assigned to project %q (its tasks: %s)", fbTask, project.Name, strings.Join(names, ", "))
+}
+
+// notFound is unknown name error suggesting close names
+func notFound(what, name string, names []string) error {
+	if name == "" {
+		return fmt.Errorf("no FreshBooks %s set", what)
+	}
+	if s := suggest(name, names); len(s) > 0 {
+		return fmt.Errorf("%s %q not found, did you mean: %s", what, name, strings.Join(s, ", "))
+	}
+	return fmt.Errorf("%s %q not found", what, name)
+}
+
+func (a *fbooks) findUser(email string) int {
+	for _, v := range a.users {
+		if strings.EqualFold(v.Email, email) {
+			return v.UserID
 		}
 	}
 	return 0
 }
 
-func (a *API) clientProjects(id int) {
+// findStaff returns FreshBooks user Entry's time is logged as: FbStaff override
+// of its JIRA author first, then the user with author's email
+func (a *fbooks) findStaff(e Entry) (int, bool) {
+	if e.Author == "" && e.Email == "" {
+		if email, ok := a.staff["*"]; ok {
+			id := a.findUser(email)
+			return id, id != 0
+		}
+		return a.owner, true
+	}
+	for _, author := range []string{e.Email, e.Author} {
+		if email, ok := a.staff[author]; ok && author != "" {
+			id := a.findUser(email)
+			return id, id != 0
+		}
+	}
+	if e.Email == "" {
+		return 0, false
+	}
+	id := a.findUser(e.Email)
+	return id, id != 0
+}
+
+// unmatchedAuthors returns JIRA authors of unbilled Entries with no FreshBooks user
+func (a *fbooks) unmatchedAuthors(allEntries Entries) []string {
+	seen := make(map[string]bool)
+	var authors []string
+	for _, v := range allEntries {
+		if v.done() {
+			continue
+		}
+		if _, ok := a.findStaff(v); ok {
+			continue
+		}
+		author := v.Author
+		if v.Email != "" {
+			author = fmt.Sprintf("%s <%s>", v.Author, v.Email)
+		}
+		if author == "" {
+			author = `"*" (time with no author)`
+		}
+		if !seen[author] {
+			seen[author] = true
+			authors = append(authors, author)
+		}
+	}
+	sort.Strings(authors)
+	return authors
+}
+
+func (a *fbooks) clientProjects(id int) {
 	for _, pr := range a.projects {
 		if pr.ClientID == id {
 			fmt.Printf("\tProject Name: %s\n", pr.Name)
@@ -45,67 +240,149 @@ func (a *API) clientProjects(id int) {
 	}
 }
 
-func (a *API) pushFB(allItems Items, fbProject string, fbTask string) {
-	for _, v := range allItems {
+// pushFB pushes unbilled Entries as time entries and records them in the run journal,
+// entries pushed before (found by their marker) are skipped or updated and
+// failed ones are handled by -onFailure
+func (a *fbooks) pushFB(allEntries Entries, project Project, tasks map[string]Task, ledger *billedLedger) {
+	existing, err := a.pushedEntries(project.ProjectID, allEntries)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "j2i: can't list time entries! %v\n", err)
+		os.Exit(1)
+	}
+
+	for _, v := range allEntries {
+		if v.done() {
+			continue
+		}
+		userID, _ := a.findStaff(v)
 		te := &TimeEntry{
-			ProjectID: a.findProject(fbProject),
-			TaskID:    a.findTask(fbTask),
-			UserID:    1,
-			Date:      v.DueDate.Format("2006-01-02"),
-			Notes:     fmt.Sprintf("%s: %s", v.Key.Val, v.Summary),
-			Hours:     float64(v.TimeSpent.Seconds) / 60 / 60,
-		}
-		id, err := a.SaveTimeEntry(te)
+			ProjectID: project.ProjectID,
+			TaskID:    tasks[v.Task].TaskID,
+			UserID:    userID,
+			Date:      v.Date.Format(dayFormat),
+			Notes:     v.Notes(),
+			Hours:     v.Hours(),
+		}
+
+		if old, ok := existing[v.marker()]; ok && sameHours(old.Hours, te.Hours) {
+			fmt.Printf("\tSkipped Time Entry: ID:%d (pushed before)\n", old.TimeEntryID)
+			te.TimeEntryID = old.TimeEntryID
+		} else {
+			if ok {
+				te.TimeEntryID = old.TimeEntryID
+			}
+			id, err := a.SaveTimeEntry(te)
+			if err != nil {
+				c.failed(fmt.Errorf("%s: %v", v.Key, err))
+				for _, p := range v.parts() {
+					c.failedKeys[p.Key] = true
+				}
+				continue
+			}
+			if ok {
+				fmt.Printf("\tUpdated Time Entry: ID:%d\n", te.TimeEntryID)
+			} else {
+				fmt.Printf("\tCreated Time Entry: ID:%d\n", id)
+				te.TimeEntryID = id
+			}
+		}
+		changes, err := ledger.record(v)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "j2i: %v\n", err)
+			fmt.Fprintf(os.Stderr, "j2i: can't record billed time! %v\n", err)
 			os.Exit(1)
 		}
-		fmt.Printf("\tCreated Time Entry: ID:%d\n", id)
+		c.journal.pushed(*te, changes)
 	}
 }
 
-func (a *API) invoiceByNum(invNumber string) (Invoice, error) {
-
-	req := struct {
-		XMLName xml.Name `xml:"request"`
-		Method  string   `xml:"method,attr"`
-		PerPage int      `xml:"per_page"`
-		Page    int      `xml:"page"`
-		Number  string   `xml:"number"`
-	}{
-		Method:  "invoice.list",
-		Page:    1,
-		PerPage: a.perPage,
-		Number:  invNumber,
+// pushedEntries returns time entries of project over the dates of unbilled
+// Entries keyed by their marker
+func (a *fbooks) pushedEntries(projectID int, allEntries Entries) (map[string]TimeEntry, error) {
+	existing := make(map[string]TimeEntry)
+	var from, to time.Time
+	for _, v := range allEntries {
+		if v.done() {
+			continue
+		}
+		if from.IsZero() || v.Date.Before(from) {
+			from = v.Date
+		}
+		if v.Date.After(to) {
+			to = v.Date
+		}
+	}
+	if from.IsZero() {
+		return existing, nil
 	}
 
-	result, err := a.makeRequest(&req)
+	entries, err := a.TimeEntries(projectID, from.Format(dayFormat), to.Format(dayFormat))
 	if err != nil {
-		return Invoice{}, err
+		return nil, err
 	}
-	parsedInto := Response{}
-	if err := xml.Unmarshal(*result, &parsedInto); err != nil {
-		return Invoice{}, (err)
-	}
-	if len(parsedInto.Error) > 0 {
-		return Invoice{}, errors.New(parsedInto.Error)
+	for _, te := range entries {
+		if m := markerRe.FindString(te.Notes); m != "" {
+			existing[m] = te
+		}
 	}
+	return existing, nil
+}
 
-	if c.trace {
-		fmt.Printf("makeRequest: %#v\n", parsedInto)
-	}
+// sameHours compares hours the way FreshBooks stores them
+func sameHours(a, b float64) bool {
+	return math.Abs(a-b) < 0.005
+}
 
-	if len(parsedInto.Invoices.Invoices) > 0 {
-		return parsedInto.Invoices.Invoices[0], nil
+// createInvoice creates draft invoice billing time entries pushed for project's client
+// and returns its number
+func (a *fbooks) createInvoice(pushed []TimeEntry, project Project) (string, error) {
+	if len(pushed) == 0 {
+		return "", errors.New("nothing was pushed to invoice")
+	}
+	clientID := project.ClientID
+	if clientID == 0 {
+		return "", fmt.Errorf("no client for project: %s", project.Name)
 	}
 
-	return Invoice{}, errors.New("Invoice Number: " + invNumber + " can't be located")
+	inv := &NewInvoice{
+		ClientID: clientID,
+		Date:     time.Now().Format("2006-01-02"),
+		Status:   "draft",
+	}
+	byID := make(map[int]Task)
+	for _, t := range a.tasks {
+		byID[t.TaskID] = t
+	}
+	for _, te := range pushed {
+		task := byID[te.TaskID]
+		inv.Lines = append(inv.Lines, InvoiceLine{
+			Name:        task.Name,
+			Description: clientNotes(te.Notes),
+			UnitCost:    task.Rate,
+			Quantity:    te.Hours,
+			Type:        "Time",
+		})
+	}
 
+	id, err := a.CreateInvoice(inv)
+	if err != nil {
+		return "", err
+	}
+	if c.dryRun {
+		number := fmt.Sprintf("DRY-RUN-%d", id)
+		fmt.Printf("\tCreated Invoice: ID:%d Number:%s\n", id, number)
+		return number, nil
+	}
+	created, err := a.Invoice(id)
+	if err != nil {
+		return "", err
+	}
+	fmt.Printf("\tCreated Invoice: ID:%d Number:%s\n", id, created.Number)
+	return created.Number, nil
 }
 
-func (a *API) invoicePDF(invNumber string, saveTo string) error {
+func (a *fbooks) invoicePDF(invNumber string, saveTo string) error {
 	var err error
-	inv, err := a.invoiceByNum(invNumber)
+	inv, err := a.InvoiceByNumber(invNumber)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "j2i: %v\n", err)
 		os.Exit(1)
@@ -118,16 +395,7 @@ func (a *API) invoicePDF(invNumber string, saveTo string) error {
 	fmt.Printf("\t%-15s: %.2f\n", "Amount", inv.Amount)
 
 	fmt.Printf("\tDownloading Invoice PDF to: %s\n", saveTo)
-	req := struct {
-		XMLName   xml.Name `xml:"request"`
-		Method    string   `xml:"method,attr"`
-		InvoiceID int      `xml:"invoice_id"`
-	}{
-		Method:    "invoice.getPDF",
-		InvoiceID: inv.InvoiceID,
-	}
-
-	result, err := a.makeRequest(&req)
+	result, err := a.InvoicePDF(inv.InvoiceID)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "j2i: %v\n", err)
 		os.Exit(1)
@@ -140,10 +408,86 @@ func (a *API) invoicePDF(invNumber string, saveTo string) error {
 	}
 	defer dst.Close()
 
-	_, err = io.Copy(dst, bytes.NewReader(*result))
+	_, err = io.Copy(dst, bytes.NewReader(result))
 	if err != nil {
 		// to close the dst via defer ...
 		return err
 	}
 	return nil
 }
+
+// invoiceMail is what InvoiceSubject and InvoiceMessage templates can use
+type invoiceMail struct {
+	Number string
+	Client string
+	Date   string
+	Amount float64
+	Period string
+}
+
+// sendInvoice emails invoice to the client once confirmed and records it to w
+func (c *appContext) sendInvoice(w io.Writer, a *fbooks, number string) error {
+	if c.dryRun {
+		fmt.Printf("DRY RUN: Invoice %s would be emailed to the client\n", number)
+		return nil
+	}
+	if c.journal.Sent != "" {
+		fmt.Fprintf(w, "\nInvoice %s was sent at %s\n", number, c.journal.Sent)
+		return nil
+	}
+	inv, err := a.InvoiceByNumber(number)
+	if err != nil {
+		return err
+	}
+	mail := invoiceMail{
+		Number: inv.Number,
+		Client: a.findClient(inv.ClientID),
+		Date:   inv.Date,
+		Amount: inv.Amount,
+		Period: c.period.String(),
+	}
+	subject, err := mailText("InvoiceSubject", c.cc.InvoiceSubject, mail)
+	if err != nil {
+		return err
+	}
+	message, err := mailText("InvoiceMessage", c.cc.InvoiceMessage, mail)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\n\tInvoice %s (%.2f) is about to be emailed to %s\n", mail.Number, mail.Amount, mail.Client)
+	if subject != "" {
+		fmt.Printf("\tSubject: %s\n", subject)
+	}
+	if message != "" {
+		fmt.Printf("\tMessage:\n\t%s\n", strings.Replace(message, "\n", "\n\t", -1))
+	}
+	if !c.confirm("\n\tSend?") {
+		fmt.Fprintf(w, "\nInvoice %s was not sent\n", mail.Number)
+		return nil
+	}
+
+	if err := a.SendInvoice(inv.InvoiceID, subject, message); err != nil {
+		return err
+	}
+	sent := time.Now().Format(time.RFC3339)
+	c.journal.record(func(j *runJournal) { j.Sent = sent })
+	fmt.Fprintf(w, "\nSent Invoice: Number:%s To:%s At:%s\n", mail.Number, mail.Client, sent)
+	return nil
+}
+
+// mailText executes template text named name with mail, no text is no template
+func mailText(name, text string, mail invoiceMail) (string, error) {
+	if text == "" {
+		return "", nil
+	}
+	t, err := template.New(name).Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var b bytes.Buffer
+	if err := t.Execute(&b, mail); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
@@ -13,8 +13,28 @@ import (
 	"github.com/tambet/oauthplain"
 )
 
+// Books is FreshBooks backend - operations j2i needs from FreshBooks
+type Books interface {
+	Clients() ([]Client, error)
+	Projects() ([]Project, error)
+	Tasks() ([]Task, error)
+	Users() ([]User, error)
+	SaveTimeEntry(timeEntry *TimeEntry) (int, error)
+	CreateInvoice(invoice *NewInvoice) (int, error)
+	Invoice(id int) (Invoice, error)
+	InvoiceByNumber(number string) (Invoice, error)
+	InvoicePDF(id int) ([]byte, error)
+	SendInvoice(id int, subject, message string) error
+	TimeEntries(projectID int, from, to string) ([]TimeEntry, error)
+	DeleteTimeEntry(id int) error
+	CreateClient(client *Client) (int, error)
+	CreateTask(task *Task) (int, error)
+	CreateProject(project *Project) (int, error)
+	UpdateProject(project *Project) error
+}
+
 type (
-	// API - Top level
+	// API - Top level (classic XML API)
 	API struct {
 		apiURL     string
 		apiToken   string
@@ -38,14 +58,22 @@ type (
 		Method    string    `xml:"method,attr"`
 		TimeEntry TimeEntry `xml:"time_entry"`
 	}
+	// InvoiceRequest - invoice specific
+	InvoiceRequest struct {
+		XMLName xml.Name   `xml:"request"`
+		Method  string     `xml:"method,attr"`
+		Invoice NewInvoice `xml:"invoice"`
+	}
 	// Response - controls API response vars
 	Response struct {
-		Error    string      `xml:"error"`
-		Clients  ClientList  `xml:"clients"`
-		Projects ProjectList `xml:"projects"`
-		Tasks    TaskList    `xml:"tasks"`
-		Users    UserList    `xml:"staff_members"`
-		Invoices InvoiceList `xml:"invoices"`
+		Error    string        `xml:"error"`
+		Clients  ClientList    `xml:"clients"`
+		Projects ProjectList   `xml:"projects"`
+		Tasks    TaskList      `xml:"tasks"`
+		Users    UserList      `xml:"staff_members"`
+		Invoices InvoiceList   `xml:"invoices"`
+		Invoice  Invoice       `xml:"invoice"`
+		Entries  TimeEntryList `xml:"time_entries"`
 	}
 	// TimeEntryResponse - time entry specific
 	TimeEntryResponse struct {
@@ -55,6 +83,41 @@ type (
 		Field       string `xml:"field"`
 		TimeEntryID int    `xml:"time_entry_id"`
 	}
+	// InvoiceResponse - invoice specific
+	InvoiceResponse struct {
+		Status    string `xml:"status,attr"`
+		Error     string `xml:"error"`
+		InvoiceID int    `xml:"invoice_id"`
+	}
+	// CreateResponse - client, project and task create/update specific
+	CreateResponse struct {
+		Status    string `xml:"status,attr"`
+		Error     string `xml:"error"`
+		ClientID  int    `xml:"client_id"`
+		ProjectID int    `xml:"project_id"`
+		TaskID    int    `xml:"task_id"`
+	}
+	// ProjectRequest - project create/update specific
+	ProjectRequest struct {
+		XMLName xml.Name    `xml:"request"`
+		Method  string      `xml:"method,attr"`
+		Project projectSave `xml:"project"`
+	}
+	// projectSave - project to create or update
+	projectSave struct {
+		ProjectID  int        `xml:"project_id,omitempty"`
+		Name       string     `xml:"name"`
+		BillMethod string     `xml:"bill_method,omitempty"`
+		ClientID   int        `xml:"client_id"`
+		Tasks      []taskRef  `xml:"tasks>task"`
+		Staff      []staffRef `xml:"staff>staff"`
+	}
+	taskRef struct {
+		TaskID int `xml:"task_id"`
+	}
+	staffRef struct {
+		StaffID int `xml:"staff_id"`
+	}
 	// Pagination - pagination controls
 	Pagination struct {
 		Page    int `xml:"page,attr"`
@@ -81,6 +144,11 @@ type (
 		Pagination
 		Users []User `xml:"member"`
 	}
+	// TimeEntryList - time entries
+	TimeEntryList struct {
+		Pagination
+		TimeEntries []TimeEntry `xml:"time_entry"`
+	}
 	// InvoiceList - invoices
 	InvoiceList struct {
 		Pagination
@@ -125,11 +193,28 @@ type (
 	// Invoice - specific Invoice
 	Invoice struct {
 		InvoiceID int     `xml:"invoice_id"`
+		ClientID  int     `xml:"client_id"`
 		Number    string  `xml:"number"`
 		Date      string  `xml:"date"`
 		PONumber  string  `xml:"po_number"`
 		Amount    float64 `xml:"amount"`
 	}
+	// NewInvoice - invoice to create
+	NewInvoice struct {
+		ClientID int           `xml:"client_id"` // Required
+		Date     string        `xml:"date"`
+		Status   string        `xml:"status"`
+		Notes    string        `xml:"notes,omitempty"`
+		Lines    []InvoiceLine `xml:"lines>line"`
+	}
+	// InvoiceLine - single invoice line
+	InvoiceLine struct {
+		Name        string  `xml:"name"`
+		Description string  `xml:"description"`
+		UnitCost    float64 `xml:"unit_cost"`
+		Quantity    float64 `xml:"quantity"`
+		Type        string  `xml:"type"` // Item or Time
+	}
 )
 
 // NewAPI - sets up new API params
@@ -277,6 +362,249 @@ func (a *API) SaveTimeEntry(timeEntry *TimeEntry) (int, error) {
 	return 0, errors.New(parsedInto.Error)
 }
 
+// TimeEntries - lists time entries of project logged between from and to (YYYY-MM-DD)
+func (a *API) TimeEntries(projectID int, from, to string) ([]TimeEntry, error) {
+	var entries []TimeEntry
+	for page := 1; ; page++ {
+		request := struct {
+			XMLName   xml.Name `xml:"request"`
+			Method    string   `xml:"method,attr"`
+			PerPage   int      `xml:"per_page"`
+			Page      int      `xml:"page"`
+			ProjectID int      `xml:"project_id"`
+			DateFrom  string   `xml:"date_from"`
+			DateTo    string   `xml:"date_to"`
+		}{
+			Method:    "time_entry.list",
+			PerPage:   a.perPage,
+			Page:      page,
+			ProjectID: projectID,
+			DateFrom:  from,
+			DateTo:    to,
+		}
+		result, err := a.makeRequest(&request)
+		if err != nil {
+			return nil, err
+		}
+		parsedInto := Response{}
+		if err := xml.Unmarshal(*result, &parsedInto); err != nil {
+			return nil, err
+		}
+		if len(parsedInto.Error) > 0 {
+			return nil, errors.New(parsedInto.Error)
+		}
+		entries = append(entries, parsedInto.Entries.TimeEntries...)
+		if parsedInto.Entries.Total <= parsedInto.Entries.PerPage*page {
+			return entries, nil
+		}
+	}
+}
+
+// DeleteTimeEntry - deletes time entry
+func (a *API) DeleteTimeEntry(id int) error {
+	request := struct {
+		XMLName     xml.Name `xml:"request"`
+		Method      string   `xml:"method,attr"`
+		TimeEntryID int      `xml:"time_entry_id"`
+	}{
+		Method:      "time_entry.delete",
+		TimeEntryID: id,
+	}
+	_, err := a.create(&request)
+	return err
+}
+
+// CreateClient - creates client and returns its ID
+func (a *API) CreateClient(client *Client) (int, error) {
+	request := struct {
+		XMLName xml.Name `xml:"request"`
+		Method  string   `xml:"method,attr"`
+		Name    string   `xml:"client>organization"`
+	}{
+		Method: "client.create",
+		Name:   client.Name,
+	}
+	parsedInto, err := a.create(&request)
+	return parsedInto.ClientID, err
+}
+
+// CreateTask - creates billable task and returns its ID
+func (a *API) CreateTask(task *Task) (int, error) {
+	request := struct {
+		XMLName  xml.Name `xml:"request"`
+		Method   string   `xml:"method,attr"`
+		Name     string   `xml:"task>name"`
+		Billable int      `xml:"task>billable"`
+		Rate     float64  `xml:"task>rate"`
+	}{
+		Method:   "task.create",
+		Name:     task.Name,
+		Billable: 1,
+		Rate:     task.Rate,
+	}
+	parsedInto, err := a.create(&request)
+	return parsedInto.TaskID, err
+}
+
+// CreateProject - creates project billed by task rate and returns its ID
+func (a *API) CreateProject(project *Project) (int, error) {
+	request := &ProjectRequest{Method: "project.create", Project: newProjectSave(project)}
+	request.Project.BillMethod = "task-rate"
+	parsedInto, err := a.create(request)
+	return parsedInto.ProjectID, err
+}
+
+// UpdateProject - sets name, tasks and staff of project
+func (a *API) UpdateProject(project *Project) error {
+	request := &ProjectRequest{Method: "project.update", Project: newProjectSave(project)}
+	request.Project.ProjectID = project.ProjectID
+	_, err := a.create(request)
+	return err
+}
+
+func newProjectSave(project *Project) projectSave {
+	ps := projectSave{Name: project.Name, ClientID: project.ClientID}
+	for _, id := range project.TaskIDs {
+		ps.Tasks = append(ps.Tasks, taskRef{id})
+	}
+	for _, id := range project.UserIDs {
+		ps.Staff = append(ps.Staff, staffRef{id})
+	}
+	return ps
+}
+
+// create sends create/update request and checks its status
+func (a *API) create(request interface{}) (CreateResponse, error) {
+	parsedInto := CreateResponse{}
+	result, err := a.makeRequest(request)
+	if err != nil {
+		return parsedInto, err
+	}
+	if err := xml.Unmarshal(*result, &parsedInto); err != nil {
+		return parsedInto, err
+	}
+	if parsedInto.Status != "ok" {
+		return parsedInto, errors.New(parsedInto.Error)
+	}
+	return parsedInto, nil
+}
+
+// CreateInvoice - creates invoice and returns its ID
+func (a *API) CreateInvoice(invoice *NewInvoice) (int, error) {
+	request := &InvoiceRequest{Method: "invoice.create", Invoice: *invoice}
+	result, err := a.makeRequest(request)
+	if err != nil {
+		return 0, err
+	}
+	parsedInto := InvoiceResponse{}
+	if err := xml.Unmarshal(*result, &parsedInto); err != nil {
+		return 0, err
+	}
+	if parsedInto.Status == "ok" {
+		return parsedInto.InvoiceID, nil
+	}
+	return 0, errors.New(parsedInto.Error)
+}
+
+// Invoice - gets invoice by its ID
+func (a *API) Invoice(id int) (Invoice, error) {
+	request := struct {
+		XMLName   xml.Name `xml:"request"`
+		Method    string   `xml:"method,attr"`
+		InvoiceID int      `xml:"invoice_id"`
+	}{
+		Method:    "invoice.get",
+		InvoiceID: id,
+	}
+	result, err := a.makeRequest(&request)
+	if err != nil {
+		return Invoice{}, err
+	}
+	parsedInto := Response{}
+	if err := xml.Unmarshal(*result, &parsedInto); err != nil {
+		return Invoice{}, err
+	}
+	if len(parsedInto.Error) > 0 {
+		return Invoice{}, errors.New(parsedInto.Error)
+	}
+	return parsedInto.Invoice, nil
+}
+
+// InvoiceByNumber - gets invoice by its number
+func (a *API) InvoiceByNumber(invNumber string) (Invoice, error) {
+	req := struct {
+		XMLName xml.Name `xml:"request"`
+		Method  string   `xml:"method,attr"`
+		PerPage int      `xml:"per_page"`
+		Page    int      `xml:"page"`
+		Number  string   `xml:"number"`
+	}{
+		Method:  "invoice.list",
+		Page:    1,
+		PerPage: a.perPage,
+		Number:  invNumber,
+	}
+
+	result, err := a.makeRequest(&req)
+	if err != nil {
+		return Invoice{}, err
+	}
+	parsedInto := Response{}
+	if err := xml.Unmarshal(*result, &parsedInto); err != nil {
+		return Invoice{}, (err)
+	}
+	if len(parsedInto.Error) > 0 {
+		return Invoice{}, errors.New(parsedInto.Error)
+	}
+
+	if c.trace {
+		fmt.Printf("makeRequest: %#v\n", parsedInto)
+	}
+
+	if len(parsedInto.Invoices.Invoices) > 0 {
+		return parsedInto.Invoices.Invoices[0], nil
+	}
+
+	return Invoice{}, errors.New("Invoice Number: " + invNumber + " can't be located")
+
+}
+
+// InvoicePDF - gets invoice PDF
+func (a *API) InvoicePDF(id int) ([]byte, error) {
+	request := struct {
+		XMLName   xml.Name `xml:"request"`
+		Method    string   `xml:"method,attr"`
+		InvoiceID int      `xml:"invoice_id"`
+	}{
+		Method:    "invoice.getPDF",
+		InvoiceID: id,
+	}
+	result, err := a.makeRequest(&request)
+	if err != nil {
+		return nil, err
+	}
+	return *result, nil
+}
+
+// SendInvoice - emails invoice to the client, empty subject or message
+// fall back to FreshBooks defaults
+func (a *API) SendInvoice(id int, subject, message string) error {
+	request := struct {
+		XMLName   xml.Name `xml:"request"`
+		Method    string   `xml:"method,attr"`
+		InvoiceID int      `xml:"invoice_id"`
+		Subject   string   `xml:"subject,omitempty"`
+		Message   string   `xml:"message,omitempty"`
+	}{
+		Method:    "invoice.sendByEmail",
+		InvoiceID: id,
+		Subject:   subject,
+		Message:   message,
+	}
+	_, err := a.create(&request)
+	return err
+}
+
 func (a *API) makeRequest(request interface{}) (*[]byte, error) {
 	xmlRequest, err := xml.MarshalIndent(request, "", "  ")
 	if err != nil {
@@ -299,7 +627,7 @@ func (a *API) makeRequest(request interface{}) (*[]byte, error) {
 		req.Header.Set("Authorization", header)
 	}
 
-	response, err := http.DefaultClient.Do(req)
+	response, err := httpClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/tambet/oauthplain"
+)
+
+// FreshBooks classic API OAuth 1.0a (PLAINTEXT) endpoints, %s is FbAccountName
+var fbOAuthConfig = &oauthplain.Config{
+	RequestTokenUrl:   "https://%s.freshbooks.com/oauth/oauth_request.php",
+	AuthorizeTokenUrl: "https://%s.freshbooks.com/oauth/oauth_authorize.php",
+	AccessTokenUrl:    "https://%s.freshbooks.com/oauth/oauth_access.php",
+}
+
+// fbToken returns OAuth token when OAuth credentials are configured,
+// FbAuthToken otherwise
+func (cfg *appConfig) fbToken() interface{} {
+	if cfg.FbConsumerKey != "" && cfg.FbOAuthToken != "" {
+		return &oauthplain.Token{
+			ConsumerKey:      cfg.FbConsumerKey,
+			ConsumerSecret:   cfg.FbConsumerSecret,
+			OAuthToken:       cfg.FbOAuthToken,
+			OAuthTokenSecret: cfg.FbOAuthTokenSecret,
+		}
+	}
+	return cfg.FbAuthToken
+}
+
+// authorizeFreshBooksClassic walks through request token / verifier / access token
+// exchange and writes the access token back to config
+func (c *appContext) authorizeFreshBooksClassic() error {
+	if c.cfg.FbAccountName == "" || c.cfg.FbConsumerKey == "" || c.cfg.FbConsumerSecret == "" {
+		return errors.New("FbAccountName, FbConsumerKey and FbConsumerSecret must be set in config")
+	}
+	conf := fbOAuthConfig.UpdateURLs(c.cfg.FbAccountName)
+	conf.ConsumerKey = c.cfg.FbConsumerKey
+	conf.ConsumerSecret = c.cfg.FbConsumerSecret
+	t := &oauthplain.Transport{Config: conf}
+
+	token, err := t.AuthCodeURL("oob")
+	if err != nil {
+		return err
+	}
+	if !interactive() {
+		return errors.New("authorize needs a terminal to paste the redirect URL into")
+	}
+	line := ask(fmt.Sprintf("\n\tOpen the URL below, grant access to %s.freshbooks.com\n\tand paste the URL you were redirected to (or the verifier)\n\n\t%s\n\n\tRedirected to: ", c.cfg.FbAccountName, token.AuthorizeUrl))
+	token.OAuthVerifier, err = oauthVerifier(line, token.OAuthToken)
+	if err != nil {
+		return err
+	}
+	token.Extra = nil
+	if err := t.Exchange(token); err != nil {
+		return err
+	}
+
+	file, err := saveConfig(map[string]interface{}{
+		"FbOAuthToken":       token.OAuthToken,
+		"FbOAuthTokenSecret": token.OAuthTokenSecret,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("\tAuthorized %s.freshbooks.com, tokens saved to %s\n", c.cfg.FbAccountName, file)
+	return nil
+}
+
+// oauthVerifier extracts oauth_verifier from redirect URL (or takes the bare verifier)
+func oauthVerifier(redirected, requestToken string) (string, error) {
+	if !strings.Contains(redirected, "?") {
+		if redirected == "" {
+			return "", errors.New("no OAuth verifier")
+		}
+		return redirected, nil
+	}
+	u, err := url.Parse(redirected)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	if t := q.Get("oauth_token"); t != "" && t != requestToken {
+		return "", errors.New("OAuth token does not match - start over")
+	}
+	if q.Get("oauth_verifier") == "" {
+		return "", errors.New("no OAuth verifier in " + redirected)
+	}
+	return q.Get("oauth_verifier"), nil
+}
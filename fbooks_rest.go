@@ -0,0 +1,650 @@
+// FreshBooks REST API
+// https://www.freshbooks.com/api/start
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+)
+
+// FreshBooks backends
+const (
+	fbClassic = "classic" // XML API - API
+	fbREST    = "rest"    // REST API - RestAPI
+)
+
+// FreshBooks OAuth 2.0 and REST API endpoints
+const (
+	fbAuthURL  = "https://auth.freshbooks.com/oauth/authorize"
+	fbTokenURL = "https://api.freshbooks.com/auth/oauth/token"
+	fbAPIURL   = "https://api.freshbooks.com"
+)
+
+// fbOAuth holds FreshBooks OAuth 2.0 tokens and the business they are used with,
+// stored in ~/.j2i/oauth/freshbooks.json and refreshed when expired
+type fbOAuth struct {
+	oauth2Token
+	file       string
+	AccountID  string
+	BusinessID int
+}
+
+type (
+	// RestAPI - Top level (REST API)
+	RestAPI struct {
+		apiURL  string
+		token   *fbOAuth
+		perPage int
+	}
+	// restError - REST API error response
+	restError struct {
+		Status int
+		Body   string
+	}
+	// restMeta - pagination of projects, time tracking and comments APIs
+	restMeta struct {
+		Page    int `json:"page"`
+		Pages   int `json:"pages"`
+		PerPage int `json:"per_page"`
+		Total   int `json:"total"`
+	}
+	// restResponse - accounting API envelope
+	restResponse struct {
+		Response struct {
+			Result json.RawMessage `json:"result"`
+			Errors []struct {
+				Message string `json:"message"`
+				Field   string `json:"field"`
+			} `json:"errors"`
+		} `json:"response"`
+	}
+	// restClient - accounting client
+	restClient struct {
+		ID           int    `json:"id"`
+		Organization string `json:"organization"`
+		Email        string `json:"email,omitempty"`
+	}
+	// restProject - project
+	restProject struct {
+		ID       int           `json:"id"`
+		Title    string        `json:"title"`
+		ClientID int           `json:"client_id"`
+		Services []restService `json:"services"`
+		Group    struct {
+			Members []struct {
+				IdentityID int `json:"identity_id"`
+			} `json:"members"`
+		} `json:"group"`
+	}
+	// restService - service (task in classic API)
+	restService struct {
+		ID   int    `json:"id"`
+		Name string `json:"name,omitempty"`
+	}
+	// restTeamMember - team member (staff in classic API)
+	restTeamMember struct {
+		IdentityID int    `json:"identity_id"`
+		Email      string `json:"email"`
+		FirstName  string `json:"first_name"`
+		LastName   string `json:"last_name"`
+	}
+	// restTimeEntry - time entry
+	restTimeEntry struct {
+		ID         int    `json:"id,omitempty"`
+		IsLogged   bool   `json:"is_logged"`
+		StartedAt  string `json:"started_at"`
+		Duration   int64  `json:"duration"`
+		Note       string `json:"note"`
+		ProjectID  int    `json:"project_id"`
+		ServiceID  int    `json:"service_id,omitempty"`
+		IdentityID int    `json:"identity_id,omitempty"`
+		Billable   bool   `json:"billable"`
+	}
+	// restInvoice - accounting invoice
+	restInvoice struct {
+		ID         int         `json:"id,omitempty"`
+		Number     string      `json:"invoice_number,omitempty"`
+		CustomerID int         `json:"customerid"`
+		CreateDate string      `json:"create_date"`
+		PONumber   string      `json:"po_number,omitempty"`
+		Amount     *restAmount `json:"amount,omitempty"`
+		Lines      []restLine  `json:"lines,omitempty"`
+	}
+	// restAmount - money
+	restAmount struct {
+		Amount string `json:"amount"`
+		Code   string `json:"code,omitempty"`
+	}
+	// restLine - invoice line
+	restLine struct {
+		Type        int        `json:"type"`
+		Name        string     `json:"name"`
+		Description string     `json:"description"`
+		Qty         float64    `json:"qty"`
+		UnitCost    restAmount `json:"unit_cost"`
+	}
+)
+
+func (e *restError) Error() string {
+	return fmt.Sprintf("HTTP Error Status returned: %d %s", e.Status, e.Body)
+}
+
+func newFbOAuth(cfg *appConfig) *fbOAuth {
+	return &fbOAuth{
+		oauth2Token: oauth2Token{
+			tokenURL:     fbTokenURL,
+			clientID:     cfg.FbClientID,
+			clientSecret: cfg.FbClientSecret,
+		},
+		file: oauthFile("freshbooks"),
+	}
+}
+
+// accessToken returns access token refreshing it when it's about to expire
+func (o *fbOAuth) accessToken() (string, error) {
+	if !o.expired() {
+		return o.AccessToken, nil
+	}
+	if c.trace {
+		fmt.Printf("fbOAuth: refreshing access token\n")
+	}
+	if err := o.refresh(); err != nil {
+		return "", fmt.Errorf("refresh of FreshBooks OAuth token failed (%v) - run: j2i authorize freshbooks", err)
+	}
+	return o.AccessToken, saveJSON(o.file, o)
+}
+
+// newRestAPI sets up REST API backend with tokens of j2i authorize freshbooks
+func (c *appContext) newRestAPI() (*RestAPI, error) {
+	o := newFbOAuth(c.cfg)
+	err := loadJSON(o.file, o)
+	if os.IsNotExist(err) {
+		return nil, errors.New("no FreshBooks OAuth tokens - run: j2i authorize freshbooks")
+	} else if err != nil {
+		return nil, err
+	}
+	return &RestAPI{apiURL: fbAPIURL, token: o, perPage: 100}, nil
+}
+
+// authorizeFreshBooks walks through the authorization code grant,
+// picks the business and stores the tokens
+func (c *appContext) authorizeFreshBooks() error {
+	if c.cfg.FbClientID == "" || c.cfg.FbClientSecret == "" || c.cfg.FbRedirect == "" {
+		return errors.New("FbClientID, FbClientSecret and FbRedirect must be set in config")
+	}
+	o := newFbOAuth(c.cfg)
+	if err := o.authorize(fbAuthURL, url.Values{}, c.cfg.FbRedirect, "FreshBooks"); err != nil {
+		return err
+	}
+
+	me := struct {
+		Response struct {
+			Memberships []struct {
+				Business struct {
+					ID        int    `json:"id"`
+					AccountID string `json:"account_id"`
+					Name      string `json:"name"`
+				} `json:"business"`
+			} `json:"business_memberships"`
+		} `json:"response"`
+	}{}
+	a := &RestAPI{apiURL: fbAPIURL, token: o}
+	if err := a.do(mGet, "/auth/api/v1/users/me", nil, nil, &me); err != nil {
+		return err
+	}
+	for _, m := range me.Response.Memberships {
+		if c.cfg.FbBusinessID == 0 || c.cfg.FbBusinessID == m.Business.ID {
+			o.BusinessID, o.AccountID = m.Business.ID, m.Business.AccountID
+			if err := saveJSON(o.file, o); err != nil {
+				return err
+			}
+			fmt.Printf("\tAuthorized business %s (ID: %d), tokens saved to %s\n", m.Business.Name, o.BusinessID, o.file)
+			return nil
+		}
+	}
+	return fmt.Errorf("authorized user is not a member of business ID: %d", c.cfg.FbBusinessID)
+}
+
+// do sends request with JSON body to path and decodes JSON response into out
+func (a *RestAPI) do(method, path string, query url.Values, body interface{}, out interface{}) error {
+	data, err := a.send(method, path, query, body, "application/json")
+	if err != nil {
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+// send sends request with JSON body to path and returns raw response
+func (a *RestAPI) send(method, path string, query url.Values, body interface{}, accept string) ([]byte, error) {
+	u := a.apiURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	var reqBody *bytes.Buffer
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		if c.trace {
+			fmt.Printf("restRequest: %s %s %v\n", method, u, string(b))
+		}
+		reqBody = bytes.NewBuffer(b)
+	} else {
+		if c.trace {
+			fmt.Printf("restRequest: %s %s\n", method, u)
+		}
+		reqBody = &bytes.Buffer{}
+	}
+
+	req, err := http.NewRequest(method, u, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	token, err := a.token.accessToken()
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Api-Version", "alpha")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", accept)
+
+	response, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	result, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode > 399 {
+		return nil, &restError{Status: response.StatusCode, Body: string(result)}
+	}
+	return result, nil
+}
+
+// accounting calls accounting API of the account and unwraps result into out
+func (a *RestAPI) accounting(method, path string, query url.Values, body interface{}, out interface{}) error {
+	parsedInto := restResponse{}
+	if err := a.do(method, "/accounting/account/"+a.token.AccountID+path, query, body, &parsedInto); err != nil {
+		return err
+	}
+	if len(parsedInto.Response.Errors) > 0 {
+		e := parsedInto.Response.Errors[0]
+		return fmt.Errorf("%s %s", e.Field, e.Message)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(parsedInto.Response.Result, out)
+}
+
+// business returns path of business scoped API (projects, timetracking, comments)
+func (a *RestAPI) business(api, path string) string {
+	return fmt.Sprintf("/%s/business/%d%s", api, a.token.BusinessID, path)
+}
+
+func (a *RestAPI) page(page int) url.Values {
+	return url.Values{"page": {strconv.Itoa(page)}, "per_page": {strconv.Itoa(a.perPage)}}
+}
+
+// Clients - lists clients
+func (a *RestAPI) Clients() ([]Client, error) {
+	var clients []Client
+	for page := 1; ; page++ {
+		result := struct {
+			Clients []restClient `json:"clients"`
+			Pages   int          `json:"pages"`
+		}{}
+		if err := a.accounting(mGet, "/users/clients", a.page(page), nil, &result); err != nil {
+			return nil, err
+		}
+		for _, v := range result.Clients {
+			clients = append(clients, Client{ClientID: v.ID, Name: v.Organization})
+		}
+		if page >= result.Pages {
+			return clients, nil
+		}
+	}
+}
+
+// Projects - lists projects with their services and members
+func (a *RestAPI) Projects() ([]Project, error) {
+	var projects []Project
+	for page := 1; ; page++ {
+		result := struct {
+			Projects []restProject `json:"projects"`
+			Meta     restMeta      `json:"meta"`
+		}{}
+		if err := a.do(mGet, a.business("projects", "/projects"), a.page(page), nil, &result); err != nil {
+			return nil, err
+		}
+		for _, v := range result.Projects {
+			pr := Project{ProjectID: v.ID, ClientID: v.ClientID, Name: v.Title}
+			for _, s := range v.Services {
+				pr.TaskIDs = append(pr.TaskIDs, s.ID)
+			}
+			for _, m := range v.Group.Members {
+				pr.UserIDs = append(pr.UserIDs, m.IdentityID)
+			}
+			projects = append(projects, pr)
+		}
+		if page >= result.Meta.Pages {
+			return projects, nil
+		}
+	}
+}
+
+// Tasks - lists services with their rates
+func (a *RestAPI) Tasks() ([]Task, error) {
+	var tasks []Task
+	for page := 1; ; page++ {
+		result := struct {
+			Services json.RawMessage `json:"services"`
+			Meta     restMeta        `json:"meta"`
+		}{}
+		if err := a.do(mGet, a.business("comments", "/services"), a.page(page), nil, &result); err != nil {
+			return nil, err
+		}
+
+		// services come as a list or as a map keyed by ID
+		var services []restService
+		if err := json.Unmarshal(result.Services, &services); err != nil {
+			byID := make(map[string]restService)
+			if err := json.Unmarshal(result.Services, &byID); err != nil {
+				return nil, err
+			}
+			for _, s := range byID {
+				services = append(services, s)
+			}
+		}
+
+		for _, s := range services {
+			rate, err := a.serviceRate(s.ID)
+			if err != nil {
+				return nil, err
+			}
+			tasks = append(tasks, Task{TaskID: s.ID, Name: s.Name, Rate: rate})
+		}
+		if page >= result.Meta.Pages {
+			return tasks, nil
+		}
+	}
+}
+
+// serviceRate returns rate of service, services without rate have none
+func (a *RestAPI) serviceRate(id int) (float64, error) {
+	result := struct {
+		ServiceRate struct {
+			Rate string `json:"rate"`
+		} `json:"service_rate"`
+	}{}
+	err := a.do(mGet, a.business("comments", fmt.Sprintf("/service/%d/rate", id)), nil, nil, &result)
+	if e, ok := err.(*restError); ok && e.Status == http.StatusNotFound {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(result.ServiceRate.Rate, 64)
+}
+
+// Users - lists team members
+func (a *RestAPI) Users() ([]User, error) {
+	var users []User
+	for page := 1; ; page++ {
+		result := struct {
+			Response []restTeamMember `json:"response"`
+			Meta     restMeta         `json:"meta"`
+		}{}
+		path := fmt.Sprintf("/auth/api/v1/businesses/%d/team_members", a.token.BusinessID)
+		if err := a.do(mGet, path, a.page(page), nil, &result); err != nil {
+			return nil, err
+		}
+		for _, v := range result.Response {
+			users = append(users, User{UserID: v.IdentityID, Email: v.Email, FirstName: v.FirstName, LastName: v.LastName})
+		}
+		if page >= result.Meta.Pages {
+			return users, nil
+		}
+	}
+}
+
+// SaveTimeEntry - updates (if TimeEntryID != 0) of creates time entry
+func (a *RestAPI) SaveTimeEntry(timeEntry *TimeEntry) (int, error) {
+	body := map[string]restTimeEntry{
+		"time_entry": {
+			IsLogged: true,
+			// noon UTC keeps the day in business timezone
+			StartedAt:  timeEntry.Date + "T12:00:00.000Z",
+			Duration:   int64(math.Floor(timeEntry.Hours*60*60 + 0.5)),
+			Note:       timeEntry.Notes,
+			ProjectID:  timeEntry.ProjectID,
+			ServiceID:  timeEntry.TaskID,
+			IdentityID: timeEntry.UserID,
+			Billable:   true,
+		},
+	}
+
+	method, path := mPost, a.business("timetracking", "/time_entries")
+	if timeEntry.TimeEntryID != 0 {
+		method, path = mPut, a.business("timetracking", fmt.Sprintf("/time_entries/%d", timeEntry.TimeEntryID))
+	}
+	result := struct {
+		TimeEntry restTimeEntry `json:"time_entry"`
+	}{}
+	if err := a.do(method, path, nil, body, &result); err != nil {
+		return 0, err
+	}
+	return result.TimeEntry.ID, nil
+}
+
+// TimeEntries - lists time entries of project started between from and to (YYYY-MM-DD)
+func (a *RestAPI) TimeEntries(projectID int, from, to string) ([]TimeEntry, error) {
+	var entries []TimeEntry
+	for page := 1; ; page++ {
+		result := struct {
+			TimeEntries []restTimeEntry `json:"time_entries"`
+			Meta        restMeta        `json:"meta"`
+		}{}
+		q := a.page(page)
+		q.Set("project_id", strconv.Itoa(projectID))
+		q.Set("started_from", from+"T00:00:00.000Z")
+		q.Set("started_to", to+"T23:59:59.999Z")
+		if err := a.do(mGet, a.business("timetracking", "/time_entries"), q, nil, &result); err != nil {
+			return nil, err
+		}
+		for _, v := range result.TimeEntries {
+			te := TimeEntry{
+				TimeEntryID: v.ID,
+				ProjectID:   v.ProjectID,
+				TaskID:      v.ServiceID,
+				UserID:      v.IdentityID,
+				Notes:       v.Note,
+				Hours:       float64(v.Duration) / 60 / 60,
+			}
+			if len(v.StartedAt) >= len(dayFormat) {
+				te.Date = v.StartedAt[:len(dayFormat)]
+			}
+			entries = append(entries, te)
+		}
+		if page >= result.Meta.Pages {
+			return entries, nil
+		}
+	}
+}
+
+// DeleteTimeEntry - deletes time entry
+func (a *RestAPI) DeleteTimeEntry(id int) error {
+	return a.do(mDelete, a.business("timetracking", fmt.Sprintf("/time_entries/%d", id)), nil, nil, nil)
+}
+
+// CreateClient - creates client and returns its ID
+func (a *RestAPI) CreateClient(client *Client) (int, error) {
+	result := struct {
+		Client restClient `json:"client"`
+	}{}
+	body := map[string]restClient{"client": {Organization: client.Name}}
+	if err := a.accounting(mPost, "/users/clients", nil, body, &result); err != nil {
+		return 0, err
+	}
+	return result.Client.ID, nil
+}
+
+// CreateTask - creates billable service with its rate and returns its ID
+func (a *RestAPI) CreateTask(task *Task) (int, error) {
+	result := struct {
+		Service restService `json:"service"`
+	}{}
+	body := map[string]interface{}{"service": map[string]interface{}{"name": task.Name, "billable": true}}
+	if err := a.do(mPost, a.business("comments", "/service"), nil, body, &result); err != nil {
+		return 0, err
+	}
+	if task.Rate != 0 {
+		rate := map[string]interface{}{"service_rate": map[string]string{"rate": strconv.FormatFloat(task.Rate, 'f', 2, 64)}}
+		path := a.business("comments", fmt.Sprintf("/service/%d/rate", result.Service.ID))
+		if err := a.do(mPost, path, nil, rate, nil); err != nil {
+			return result.Service.ID, err
+		}
+	}
+	return result.Service.ID, nil
+}
+
+// CreateProject - creates project billed by service rate and returns its ID
+func (a *RestAPI) CreateProject(project *Project) (int, error) {
+	result := struct {
+		Project restProject `json:"project"`
+	}{}
+	body := map[string]interface{}{"project": a.projectSave(project)}
+	if err := a.do(mPost, a.business("projects", "/project"), nil, body, &result); err != nil {
+		return 0, err
+	}
+	return result.Project.ID, nil
+}
+
+// UpdateProject - sets title and services of project, team members
+// are assigned to projects in FreshBooks - REST API doesn't do it
+func (a *RestAPI) UpdateProject(project *Project) error {
+	body := map[string]interface{}{"project": a.projectSave(project)}
+	return a.do(mPut, a.business("projects", fmt.Sprintf("/project/%d", project.ProjectID)), nil, body, nil)
+}
+
+func (a *RestAPI) projectSave(project *Project) map[string]interface{} {
+	services := []restService{}
+	for _, id := range project.TaskIDs {
+		services = append(services, restService{ID: id})
+	}
+	return map[string]interface{}{
+		"title":          project.Name,
+		"client_id":      project.ClientID,
+		"project_type":   "hourly_rate",
+		"billing_method": "service_rate",
+		"services":       services,
+	}
+}
+
+// CreateInvoice - creates invoice and returns its ID
+func (a *RestAPI) CreateInvoice(invoice *NewInvoice) (int, error) {
+	inv := restInvoice{CustomerID: invoice.ClientID, CreateDate: invoice.Date}
+	for _, l := range invoice.Lines {
+		inv.Lines = append(inv.Lines, restLine{
+			Name:        l.Name,
+			Description: l.Description,
+			Qty:         l.Quantity,
+			UnitCost:    restAmount{Amount: strconv.FormatFloat(l.UnitCost, 'f', 2, 64)},
+		})
+	}
+	result := struct {
+		Invoice restInvoice `json:"invoice"`
+	}{}
+	if err := a.accounting(mPost, "/invoices/invoices", nil, map[string]restInvoice{"invoice": inv}, &result); err != nil {
+		return 0, err
+	}
+	return result.Invoice.ID, nil
+}
+
+// Invoice - gets invoice by its ID
+func (a *RestAPI) Invoice(id int) (Invoice, error) {
+	result := struct {
+		Invoice restInvoice `json:"invoice"`
+	}{}
+	if err := a.accounting(mGet, fmt.Sprintf("/invoices/invoices/%d", id), nil, nil, &result); err != nil {
+		return Invoice{}, err
+	}
+	return result.Invoice.invoice(), nil
+}
+
+// InvoiceByNumber - gets invoice by its number
+func (a *RestAPI) InvoiceByNumber(number string) (Invoice, error) {
+	result := struct {
+		Invoices []restInvoice `json:"invoices"`
+	}{}
+	q := url.Values{"search[invoice_number]": {number}}
+	if err := a.accounting(mGet, "/invoices/invoices", q, nil, &result); err != nil {
+		return Invoice{}, err
+	}
+	if len(result.Invoices) > 0 {
+		return result.Invoices[0].invoice(), nil
+	}
+	return Invoice{}, errors.New("Invoice Number: " + number + " can't be located")
+}
+
+// InvoicePDF - gets invoice PDF
+func (a *RestAPI) InvoicePDF(id int) ([]byte, error) {
+	return a.send(mGet, fmt.Sprintf("/accounting/account/%s/invoices/invoices/%d/pdf", a.token.AccountID, id), nil, nil, "application/pdf")
+}
+
+// SendInvoice - emails invoice to the client's email, empty subject or message
+// fall back to FreshBooks defaults
+func (a *RestAPI) SendInvoice(id int, subject, message string) error {
+	inv, err := a.Invoice(id)
+	if err != nil {
+		return err
+	}
+	client := struct {
+		Client restClient `json:"client"`
+	}{}
+	if err := a.accounting(mGet, fmt.Sprintf("/users/clients/%d", inv.ClientID), nil, nil, &client); err != nil {
+		return err
+	}
+	if client.Client.Email == "" {
+		return fmt.Errorf("client %s has no email to send the invoice to", client.Client.Organization)
+	}
+
+	send := map[string]interface{}{
+		"action_email":     true,
+		"email_recipients": []string{client.Client.Email},
+	}
+	if subject != "" || message != "" {
+		send["invoice_customized_email"] = map[string]string{"subject": subject, "body": message}
+	}
+	body := map[string]interface{}{"invoice": send}
+	return a.accounting(mPut, fmt.Sprintf("/invoices/invoices/%d", id), nil, body, nil)
+}
+
+func (v restInvoice) invoice() Invoice {
+	inv := Invoice{
+		InvoiceID: v.ID,
+		ClientID:  v.CustomerID,
+		Number:    v.Number,
+		Date:      v.CreateDate,
+		PONumber:  v.PONumber,
+	}
+	if v.Amount != nil {
+		inv.Amount, _ = strconv.ParseFloat(v.Amount.Amount, 64)
+	}
+	return inv
+}
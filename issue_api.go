@@ -3,6 +3,7 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"strconv"
 )
 
 // Credit - https://github.com/pcrawfor/jira
@@ -24,8 +25,8 @@ type Issue struct {
 // IssueList is the type representing of a list of Jira Issues as defined by their API response structure
 type IssueList struct {
 	Expand     string   `json:"expand,omitempty"`
-	StartAt    int      `json:"starts_at,omitempty"`
-	MaxResults int      `json:"max_results,omitempty"`
+	StartAt    int      `json:"startAt,omitempty"`
+	MaxResults int      `json:"maxResults,omitempty"`
 	Total      int      `json:"total,omitempty"`
 	Issues     []*Issue `json:"issues,omitempty"`
 	//Pagination *Pagination
@@ -71,6 +72,22 @@ func (i *IssueService) Label(key, labelID string) ([]byte, error) {
 	return i.client.execRequest(mPut, i.client.baseurl+url, params)
 }
 
+// Unlabel removes label from the issue and comments on why
+func (i *IssueService) Unlabel(key, labelID, comment string) ([]byte, error) {
+	url := issueBasePath + key
+
+	params := map[string]interface{}{
+		"update": map[string]interface{}{
+			"labels": []interface{}{map[string]string{"remove": labelID}},
+			"comment": []interface{}{map[string]interface{}{
+				"add": map[string]string{"body": comment},
+			}},
+		},
+	}
+
+	return i.client.execRequest(mPut, i.client.baseurl+url, params)
+}
+
 // Transition executes a transition for the given issue key to the given transition ID or returns an error
 func (i *IssueService) Transition(key, transitionID string) ([]byte, error) {
 	url := issueBasePath + key + "/transitions"
@@ -118,3 +135,54 @@ func (i *IssueService) GetTransitions(key string) (*TransitionList, error) {
 
 	return &transitions, nil
 }
+
+// WorklogList is the type representing a page of Jira worklogs as defined by their API response structure
+type WorklogList struct {
+	StartAt    int        `json:"startAt,omitempty"`
+	MaxResults int        `json:"maxResults,omitempty"`
+	Total      int        `json:"total,omitempty"`
+	Worklogs   []*Worklog `json:"worklogs,omitempty"`
+}
+
+// Worklog is the type representing a single Jira worklog entry
+type Worklog struct {
+	ID               string     `json:"id,omitempty"`
+	Author           WorkAuthor `json:"author,omitempty"`
+	Comment          string     `json:"comment,omitempty"`
+	Started          string     `json:"started,omitempty"`
+	TimeSpentSeconds int64      `json:"timeSpentSeconds,omitempty"`
+}
+
+// WorkAuthor is the type representing the Jira user who logged a Worklog
+type WorkAuthor struct {
+	Name         string `json:"name,omitempty"`
+	EmailAddress string `json:"emailAddress,omitempty"`
+	DisplayName  string `json:"displayName,omitempty"`
+}
+
+// GetWorklogs loads all worklogs for a given issue key paging through the results
+func (i *IssueService) GetWorklogs(key string) ([]*Worklog, error) {
+	var all []*Worklog
+	for {
+		params := map[string]string{
+			"startAt":    strconv.Itoa(len(all)),
+			"maxResults": strconv.Itoa(i.client.maxResults),
+		}
+		b, e := i.client.execRequest(mGet, i.client.buildURL("issue/"+key+"/worklog", params), nil)
+		if e != nil {
+			return nil, e
+		}
+
+		worklogs := WorklogList{}
+		werr := json.Unmarshal(b, &worklogs)
+		if werr != nil {
+			fmt.Println("Worklogs error: ", werr)
+			return nil, werr
+		}
+
+		all = append(all, worklogs.Worklogs...)
+		if len(worklogs.Worklogs) == 0 || len(all) >= worklogs.Total {
+			return all, nil
+		}
+	}
+}
@@ -1,8 +1,8 @@
 package main
 
 import (
-	"bufio"
 	"bytes"
+	"encoding/json"
 	"encoding/xml"
 	"errors"
 	"fmt"
@@ -10,8 +10,8 @@ import (
 	"io/ioutil"
 	"net/http"
 	"os"
-	"os/user"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -22,33 +22,177 @@ type ItemKey struct {
 	Val string `xml:",chardata"`
 }
 
+// ItemLink is parent or epic of the Item
+type ItemLink struct {
+	Key     string `xml:",chardata"`
+	Summary string
+}
+
 // ItemTimeSpent is part of the Item
 type ItemTimeSpent struct {
 	Seconds int64  `xml:"seconds,attr"`
 	Val     string `xml:",chardata"`
 }
 
+// ItemCustomField is custom field of the Item in the XML feed
+type ItemCustomField struct {
+	ID     string   `xml:"id,attr"`
+	Values []string `xml:"customfieldvalues>customfieldvalue"`
+}
+
 // Item is the top level item
 type Item struct {
-	Key       ItemKey `xml:"key"`
-	Summary   string  `xml:"summary"`
-	Due       string  `xml:"due"`
-	DueDate   time.Time
-	TimeSpent ItemTimeSpent `xml:"timespent"`
+	Key          ItemKey             `xml:"key"`
+	Summary      string              `xml:"summary"`
+	Status       string              `xml:"status"`
+	Type         string              `xml:"type"`
+	Labels       []string            `xml:"labels>label"`
+	Components   []string            `xml:"component"`
+	CustomFields []ItemCustomField   `xml:"customfields>customfield"`
+	Fields       map[string][]string // custom field ID to its values
+	Due          string              `xml:"due"`
+	Resolved     string              `xml:"resolved"`
+	Updated      string              `xml:"updated"`
+	Date         time.Time           // billing date picked by dateSources
+	DateSrc      string              // date source Date came from
+	Task         string              // FreshBooks task picked by task rules
+	Parent       ItemLink            `xml:"parent"`
+	Epic         ItemLink
+	TimeSpent    ItemTimeSpent `xml:"timespent"`
+	Billed       int64         // seconds already billed on previous runs
+	Worklogs     []ItemWorklog
+}
+
+// ItemWorklog is a single unit of work logged against the Item
+type ItemWorklog struct {
+	ID      string
+	Author  string
+	Email   string
+	Started time.Time
+	Seconds int64
+	Billed  int64
+	Comment string
 }
 
 // Items are collection of Item
 type Items []Item
 
+// Item sources
+const (
+	sourceJQL  = "jql"  // paginated JQL search through JIRA REST API
+	sourceFeed = "feed" // searchrequest-xml RSS feed (limited to feedMax issues)
+)
+
+const feedMax = 1000
+
+// itemFields are JIRA REST fields needed to build an Item
+var itemFields = []string{"summary", "status", "issuetype", "labels", "components", "timespent", "duedate", "resolutiondate", "updated", "parent"}
+
+// issueItem converts JIRA REST Issue into the same Item parseXML produces
+func issueItem(is *Issue) Item {
+	var this Item
+	this.Key.ID, _ = strconv.ParseInt(is.ID, 10, 64)
+	this.Key.Val = is.Key
+	if v, ok := is.Fields["summary"].(string); ok {
+		this.Summary = v
+	}
+	if v, ok := is.Fields["status"].(map[string]interface{}); ok {
+		this.Status, _ = v["name"].(string)
+	}
+	if v, ok := is.Fields["issuetype"].(map[string]interface{}); ok {
+		this.Type, _ = v["name"].(string)
+	}
+	this.Labels = fieldValues(is.Fields["labels"])
+	this.Components = fieldValues(is.Fields["components"])
+	for _, f := range c.cc.taskFields() {
+		if this.Fields == nil {
+			this.Fields = make(map[string][]string)
+		}
+		this.Fields[f] = fieldValues(is.Fields[f])
+	}
+	if v, ok := is.Fields["duedate"].(string); ok {
+		this.Due = v
+	}
+	if v, ok := is.Fields["resolutiondate"].(string); ok {
+		this.Resolved = v
+	}
+	if v, ok := is.Fields["updated"].(string); ok {
+		this.Updated = v
+	}
+	if v, ok := is.Fields["timespent"].(float64); ok {
+		this.TimeSpent.Seconds = int64(v)
+	}
+	if v, ok := is.Fields[c.cfg.epicField()].(string); ok {
+		this.Epic.Key = v
+	}
+	if v, ok := is.Fields["parent"].(map[string]interface{}); ok {
+		link := ItemLink{}
+		link.Key, _ = v["key"].(string)
+		pf, _ := v["fields"].(map[string]interface{})
+		link.Summary, _ = pf["summary"].(string)
+		it, _ := pf["issuetype"].(map[string]interface{})
+		if name, _ := it["name"].(string); name == "Epic" {
+			// team-managed projects link epics as parents
+			this.Epic = link
+		} else {
+			this.Parent = link
+		}
+	}
+	return this
+}
+
+// searchItems loads all Items matching JQL query paging through JIRA search results
+func (c *appContext) searchItems(jql string) (Items, error) {
+	return c.searchWith(c.newJira(), jql)
+}
+
+// searchWith loads Items matching JQL query through JIRA client j
+func (c *appContext) searchWith(j *Jira, jql string) (Items, error) {
+	issues, err := j.SearchWithFields(jql, append(append(itemFields, c.cfg.epicField()), c.cc.taskFields()...))
+	if err != nil {
+		return nil, err
+	}
+	var allItems Items
+	for _, is := range issues {
+		allItems = append(allItems, issueItem(is))
+	}
+	return allItems, nil
+}
+
+// feedItems downloads and parses searchrequest-xml feed of JIRA Search Filter ID
+func (c *appContext) feedItems(filterID string) (Items, error) {
+	if c.cc.jiraOAuth {
+		return nil, fmt.Errorf("-source=%s is not available with JIRA OAuth - use -source=%s", sourceFeed, sourceJQL)
+	}
+	url := fmt.Sprintf("%s/sr/jira.issueviews:searchrequest-xml/%s/SearchRequest-%s.xml?tempMax=%d&field=key&field=summary&field=status&field=timespent&field=due&field=resolved&field=updated&field=type&field=labels&field=components", strings.TrimRight(c.cc.JiraBaseURL, "/"), filterID, filterID, feedMax)
+	for _, f := range c.cc.taskFields() {
+		url += "&field=" + f
+	}
+	if c.cc.JiraToken == "" {
+		url += "&os_authType=basic"
+	}
+	x, err := c.downloadItems(url)
+	if err != nil {
+		return nil, err
+	}
+	allItems := parseXML(x)
+	if len(allItems) >= feedMax {
+		fmt.Fprintf(os.Stderr, "j2i: WARNING feed is capped at %d issues - use -source=%s\n", feedMax, sourceJQL)
+	}
+	return allItems, nil
+}
+
 func (c *appContext) downloadItems(u string) ([]byte, error) {
 	req, err := http.NewRequest("GET", u, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	req.SetBasicAuth(c.cfg.JiraUname, c.cfg.JiraPass)
+	if err := c.jiraAuth().Apply(req); err != nil {
+		return nil, err
+	}
 
-	response, err := http.DefaultClient.Do(req)
+	response, err := httpClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -68,9 +212,60 @@ func (c *appContext) downloadItems(u string) ([]byte, error) {
 
 }
 
+// readItems reads saved searchrequest-xml feed or JSON search export
+// from path (- is stdin) instead of downloading it from JIRA
+func readItems(path string) (Items, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	x, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(bytes.TrimSpace(x), []byte("{")) {
+		return parseJSON(x)
+	}
+	return parseXML(x), nil
+}
+
+// parseJSON parses JIRA REST search response, worklogs embedded
+// in the worklog field (if it was requested) are kept on the Item
+func parseJSON(x []byte) (Items, error) {
+	issueList := IssueList{}
+	if err := json.Unmarshal(x, &issueList); err != nil {
+		return nil, err
+	}
+
+	var allItems Items
+	for _, is := range issueList.Issues {
+		this := issueItem(is)
+		if wf, ok := is.Fields["worklog"]; ok && wf != nil {
+			b, err := json.Marshal(wf)
+			if err != nil {
+				return nil, err
+			}
+			wl := WorklogList{}
+			if err := json.Unmarshal(b, &wl); err != nil {
+				return nil, err
+			}
+			if this.Worklogs, err = itemWorklogs(is.Key, wl.Worklogs); err != nil {
+				return nil, err
+			}
+		}
+		allItems = append(allItems, this)
+	}
+	return allItems, nil
+}
+
 func parseXML(x []byte) Items {
 	var allItems Items
-	//dec := xml.NewDecoder(os.Stdin)
 	dec := xml.NewDecoder(bytes.NewReader(x))
 	for {
 		tok, err := dec.Token()
@@ -87,6 +282,12 @@ func parseXML(x []byte) Items {
 				// and when it is it gets it's value from last iteration
 				var this Item
 				dec.DecodeElement(&this, &tok)
+				for _, f := range this.CustomFields {
+					if this.Fields == nil {
+						this.Fields = make(map[string][]string)
+					}
+					this.Fields[f.ID] = f.Values
+				}
 				allItems = append(allItems, this)
 			}
 		}
@@ -94,65 +295,270 @@ func parseXML(x []byte) Items {
 	return allItems
 }
 
-func (c *appContext) updateTrans(v Item, j *Jira) {
-	r, err := j.IssuesService.Transition(v.Key.Val, c.cfg.JiraInvoicedTransID)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "j2i: Resp: %v\n", string(r))
-		fmt.Fprintf(os.Stderr, "j2i: Error: %v\n", err)
-		os.Exit(1)
+// newJira returns Jira REST client for the client's JIRA instance
+func (c *appContext) newJira() *Jira {
+	return NewJiraClient(c.jiraURL(), c.jiraAuth(), 1500)
+}
+
+// jiraOAuth returns OAuth tokens of the client's JIRA Cloud site
+func (c *appContext) jiraOAuth() *jiraOAuth {
+	if c.oauth == nil {
+		o, err := newJiraOAuth(c.cfg, c.cc.JiraBaseURL)
+		if err == nil {
+			err = o.load()
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "j2i: %v\n", err)
+			os.Exit(1)
+		}
+		c.oauth = o
 	}
-	if c.trace {
-		fmt.Printf("%v\n", string(r))
+	return c.oauth
+}
+
+// jiraURL returns base URL JIRA REST API is reached on
+func (c *appContext) jiraURL() string {
+	if c.cc.jiraOAuth {
+		return c.jiraOAuth().apiURL()
+	}
+	return c.cc.JiraBaseURL
+}
+
+// jiraAuth returns credentials of the client's JIRA instance, in order
+// of preference: OAuth, personal access token, API token, password
+func (c *appContext) jiraAuth() Auth {
+	switch {
+	case c.cc.jiraOAuth:
+		return Auth{TokenSource: c.jiraOAuth().accessToken}
+	case c.cc.JiraToken != "":
+		return Auth{Token: c.cc.JiraToken}
+	case c.cc.JiraEmail != "":
+		return Auth{Username: c.cc.JiraEmail, Password: c.cc.JiraAPIToken}
+	}
+	return Auth{Username: c.cc.JiraUname, Password: c.cc.JiraPass}
+}
+
+// itemWorklogs converts JIRA REST worklogs of issue key into ItemWorklogs
+func itemWorklogs(key string, wl []*Worklog) ([]ItemWorklog, error) {
+	var all []ItemWorklog
+	for _, w := range wl {
+		//                                 2016-04-04T09:00:00.000-0700
+		started, err := time.Parse("2006-01-02T15:04:05.000-0700", w.Started)
+		if err != nil {
+			return nil, fmt.Errorf("worklog %s on %s: %v", w.ID, key, err)
+		}
+		author := w.Author.Name
+		if author == "" {
+			author = w.Author.DisplayName
+		}
+		all = append(all, ItemWorklog{
+			ID:      w.ID,
+			Author:  author,
+			Email:   w.Author.EmailAddress,
+			Started: started,
+			Seconds: w.TimeSpentSeconds,
+			Comment: strings.TrimSpace(w.Comment),
+		})
 	}
-	fmt.Printf("\tTransitioned ISSUE:%s to ID:%s\n", v.Key.Val, c.cfg.JiraInvoicedTransID)
+	return all, nil
 }
 
-func (c *appContext) updateLabel(v Item, j *Jira, invoice string) {
-	r, err := j.IssuesService.Label(v.Key.Val, c.cfg.JiraInvoicedPrefix+invoice)
+// fetchWorklogs loads individual worklogs for every Item from JIRA
+func (c *appContext) fetchWorklogs(allItems Items, j *Jira) error {
+	for i, v := range allItems {
+		wl, err := j.IssuesService.GetWorklogs(v.Key.Val)
+		if err != nil {
+			return fmt.Errorf("worklogs for %s: %v", v.Key.Val, err)
+		}
+		allItems[i].Worklogs, err = itemWorklogs(v.Key.Val, wl)
+		if err != nil {
+			return err
+		}
+		if c.trace {
+			fmt.Printf("%s: %#v\n", v.Key.Val, allItems[i].Worklogs)
+		}
+	}
+	return nil
+}
+
+func (c *appContext) updateTrans(key string, j *Jira, t Transition) error {
+	r, err := j.IssuesService.Transition(key, t.ID)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "j2i: Resp: %v\n", string(r))
-		fmt.Fprintf(os.Stderr, "j2i: Error: %v\n", err)
-		os.Exit(1)
+		return err
 	}
 	if c.trace {
 		fmt.Printf("%v\n", string(r))
 	}
-	fmt.Printf("\tLabeled ISSUE:%s as %s\n", v.Key.Val, c.cfg.JiraInvoicedPrefix+invoice)
+	fmt.Printf("\tTransitioned ISSUE:%s to %s (ID:%s)\n", key, t.status(), t.ID)
+	return nil
+}
 
+// status returns name of the status transition t moves issue to
+func (t Transition) status() string {
+	name, _ := t.To["name"].(string)
+	return name
 }
 
-func (c *appContext) updateItems(allItems Items, a *API) {
-	url := fmt.Sprintf("https://%s.atlassian.net", c.cfg.JiraAccountName)
-	j := NewJiraClient(url, c.cfg.JiraUname, c.cfg.JiraPass, 1500)
+// transitionTo finds transition of issue key to status (transition id when
+// status isn't set) among the transitions available to the issue
+func (c *appContext) transitionTo(j *Jira, key, status, id string) (Transition, error) {
+	list, err := j.IssuesService.GetTransitions(key)
+	if err != nil {
+		return Transition{}, err
+	}
+	var available []string
+	for _, t := range list.Transitions {
+		if (status != "" && strings.EqualFold(t.status(), status)) || (status == "" && t.ID == id) {
+			return t, nil
+		}
+		available = append(available, fmt.Sprintf("%s (ID:%s) to %s", t.Name, t.ID, t.status()))
+	}
+	target := status
+	if target == "" {
+		target = "ID:" + id
+	}
+	if len(available) == 0 {
+		return Transition{}, fmt.Errorf("no transition to %s, the issue has none", target)
+	}
+	return Transition{}, fmt.Errorf("no transition to %s, available: %s", target, strings.Join(available, ", "))
+}
 
-	reader := bufio.NewReader(os.Stdin)
-	fmt.Print("\n\tThe above entries were uploaded to FreshBooks,\n\tcreate an invoice and enter it's number below\n\n\tInvoice Num: ")
-	invoice, _ := reader.ReadString('\n')
-	fmt.Printf("\tSetting Invoice to: %s\n", invoice)
+// invoicedTransitions resolves transition to the invoiced status of every item
+// still to be moved and reports items that can't be moved there
+func (c *appContext) invoicedTransitions(allItems Items, j *Jira) (map[string]Transition, int) {
+	trans := make(map[string]Transition)
+	status, id := c.cc.InvoicedStatus, c.cc.TransID
+	if status == "" && id == "" {
+		fmt.Printf("\tNo InvoicedStatus or TransID - issues are only labeled\n")
+		return trans, 0
+	}
 
-	// need to trim \n! - it gets translated to &#xA; in XML call to FB!
-	invoice = strings.TrimSpace(invoice)
+	var report []string
+	for _, v := range allItems {
+		key := v.Key.Val
+		if c.journal.transitioned(key) || c.failedKeys[key] {
+			continue
+		}
+		if status != "" && strings.EqualFold(v.Status, status) {
+			fmt.Printf("\tISSUE:%s is %s already\n", key, v.Status)
+			continue
+		}
+		t, err := c.transitionTo(j, key, status, id)
+		if err != nil {
+			report = append(report, fmt.Sprintf("%s (%s): %v", key, v.Status, err))
+			continue
+		}
+		trans[key] = t
+	}
+	if len(report) > 0 {
+		fmt.Printf("\n\tThese issues can't be transitioned, they are only labeled:\n")
+		for _, r := range report {
+			fmt.Printf("\t  %s\n", r)
+		}
+	}
+	return trans, len(report)
+}
 
-	usr, err := user.Current()
+func (c *appContext) updateLabel(v Item, j *Jira, invoice string) error {
+	r, err := j.IssuesService.Label(v.Key.Val, c.cc.InvoicedPrefix+invoice)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Unable to get current user %s", err)
-		os.Exit(1)
+		fmt.Fprintf(os.Stderr, "j2i: Resp: %v\n", string(r))
+		return err
 	}
+	if c.trace {
+		fmt.Printf("%v\n", string(r))
+	}
+	fmt.Printf("\tLabeled ISSUE:%s as %s\n", v.Key.Val, c.cc.InvoicedPrefix+invoice)
+	return nil
+}
 
-	a.invoicePDF(invoice, filepath.Join(usr.HomeDir, "Desktop", "Invoice_"+c.client+"-"+invoice+".pdf"))
+// billedItems returns items the run billed: time pushed to FreshBooks
+// (ledger changes in the journal) or, without -doFB, unbilled time
+func (c *appContext) billedItems(allItems Items, allEntries Entries) Items {
+	keys := make(map[string]bool)
+	if c.doFB {
+		for _, ch := range c.journal.Billed {
+			keys[ch.Key] = true
+		}
+	} else {
+		for _, e := range allEntries.pending() {
+			for _, p := range e.parts() {
+				keys[p.Key] = true
+			}
+		}
+	}
+	var billed Items
+	for _, v := range allItems {
+		if keys[v.Key.Val] {
+			billed = append(billed, v)
+		}
+	}
+	return billed
+}
 
-	fmt.Print("\n\tIf everythins looks good enter \"y\" at the prompt below\n\tthis will update JIRA with Invoice# and close these Issues\n\n")
-	for {
-		fmt.Print("\tReady? [y|n]: ")
-		ready, _ := reader.ReadString('\n')
-		if strings.HasPrefix(strings.ToLower(ready), "y") {
-			break
+// updateItems downloads invoice PDF, labels items with invoice number and moves
+// them to InvoicedStatus once it's confirmed (false when it's not), without
+// invoice (it wasn't created by j2i nor given by -invoice) its number is asked for
+func (c *appContext) updateItems(allItems Items, a *fbooks, invoice string) (string, bool) {
+	if len(allItems) == 0 {
+		fmt.Printf("\tNothing was billed - JIRA is not updated\n")
+		return invoice, false
+	}
+	j := c.newJira()
+
+	if invoice == "" {
+		invoice = ask("\n\tThe above entries were uploaded to FreshBooks,\n\tcreate an invoice and enter it's number below\n\n\tInvoice Num: ")
+		if invoice == "" {
+			fmt.Fprintf(os.Stderr, "j2i: no invoice number - create the invoice in FreshBooks and resume the run with -invoice\n")
+			c.resumeHint()
+			os.Exit(exitFailed)
 		}
+		fmt.Printf("\tSetting Invoice to: %s\n", invoice)
+		c.journal.record(func(r *runJournal) { r.Invoice = invoice })
+	}
 
+	if c.dryRun {
+		fmt.Printf("DRY RUN: Invoice %s PDF is not downloaded\n", invoice)
+	} else {
+		if c.journal.PDF == "" {
+			pdf := filepath.Join(c.cc.PDFDir, "Invoice_"+c.client+"-"+invoice+".pdf")
+			a.invoicePDF(invoice, pdf)
+			c.journal.record(func(r *runJournal) { r.PDF = pdf })
+		}
+	}
+	trans, stuck := c.invoicedTransitions(allItems, j)
+	if !c.dryRun {
+		fmt.Print("\n\tIf everythins looks good enter \"y\" at the prompt below\n\tthis will update JIRA with Invoice# and close these Issues\n\n")
+		if !c.confirm("\tReady?") {
+			fmt.Printf("\tJIRA was not updated\n")
+			return invoice, false
+		}
 	}
 
 	for _, v := range allItems {
-		c.updateTrans(v, j)
-		c.updateLabel(v, j, invoice)
+		key := v.Key.Val
+		if c.failedKeys[key] {
+			fmt.Printf("\tSkipped ISSUE:%s (its time entry failed)\n", key)
+			continue
+		}
+		if t, ok := trans[key]; ok && !c.journal.transitioned(key) {
+			if err := c.updateTrans(key, j, t); err != nil {
+				c.failed(fmt.Errorf("%s: %v", key, err))
+				continue
+			}
+			c.journal.record(func(r *runJournal) { r.Transitioned = append(r.Transitioned, key) })
+		}
+		if !c.journal.labeled(key) {
+			if err := c.updateLabel(v, j, invoice); err != nil {
+				c.failed(fmt.Errorf("%s: %v", key, err))
+				continue
+			}
+			c.journal.record(func(r *runJournal) { r.Labeled = append(r.Labeled, key) })
+		}
+	}
+	if stuck > 0 {
+		c.exitWith(exitPartial)
 	}
+	return invoice, true
 }
@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
 )
 
 // Credit - https://github.com/pcrawfor/jira
@@ -19,6 +20,7 @@ const defaultMaxResults = 200
 const mPost = "POST"
 const mGet = "GET"
 const mPut = "PUT"
+const mDelete = "DELETE"
 
 // Jira is a client object with functions to make reuqests to the jira api
 type Jira struct {
@@ -26,13 +28,36 @@ type Jira struct {
 	baseurl       string
 	auth          Auth
 	maxResults    int
+	validate      bool // search fails on unknown keys, values ... of JQL, otherwise they are only warnings
 	IssuesService *IssueService
 }
 
 // Auth contains username and password attributes used for api request authentication
+// (JIRA Cloud takes account email as Username and API token as Password),
+// Token is a personal access token (JIRA Server / Data Center) sent as bearer instead of basic auth,
+// TokenSource returns OAuth 2.0 access token, refreshing it as needed, and wins over the others
 type Auth struct {
-	Username string
-	Password string
+	Username    string
+	Password    string
+	Token       string
+	TokenSource func() (string, error)
+}
+
+// Apply sets authentication header of the request
+func (a Auth) Apply(req *http.Request) error {
+	switch {
+	case a.TokenSource != nil:
+		token, err := a.TokenSource()
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	case a.Token != "":
+		req.Header.Set("Authorization", "Bearer "+a.Token)
+	case a.Username != "":
+		req.SetBasicAuth(a.Username, a.Password)
+	}
+	return nil
 }
 
 func (i *Issue) String() string {
@@ -40,11 +65,11 @@ func (i *Issue) String() string {
 }
 
 // NewJiraClient returns an instance of the Jira api client
-func NewJiraClient(baseurl, username, password string, maxResults int) *Jira {
+func NewJiraClient(baseurl string, auth Auth, maxResults int) *Jira {
 	if maxResults == -1 {
 		maxResults = defaultMaxResults
 	}
-	j := &Jira{client: &http.Client{}, baseurl: baseurl, auth: Auth{username, password}, maxResults: maxResults}
+	j := &Jira{client: httpClient, baseurl: strings.TrimRight(baseurl, "/"), auth: auth, maxResults: maxResults, validate: true}
 	j.IssuesService = &IssueService{j}
 
 	return j
@@ -57,8 +82,24 @@ func (j *Jira) Search(query string) ([]*Issue, error) {
 	return j.SearchWithFields(query, nil)
 }
 
-// SearchWithFields runs an arbitrary search request and builds the set of fields to be returned by the response as defined in the fields param
+// SearchWithFields runs an arbitrary search request and builds the set of fields to be returned by the response as defined in the fields param,
+// it pages through the results until all issues matching the query are loaded
 func (j *Jira) SearchWithFields(query string, fields []string) ([]*Issue, error) {
+	var issues []*Issue
+	for {
+		issueList, err := j.SearchPage(query, fields, len(issues))
+		if err != nil {
+			return nil, err
+		}
+		issues = append(issues, issueList.Issues...)
+		if len(issueList.Issues) == 0 || len(issues) >= issueList.Total {
+			return issues, nil
+		}
+	}
+}
+
+// SearchPage runs a search request returning a single page of results starting at startAt
+func (j *Jira) SearchPage(query string, fields []string, startAt int) (*IssueList, error) {
 	max := strconv.Itoa(j.maxResults)
 
 	useFields := "id,summary"
@@ -69,8 +110,9 @@ func (j *Jira) SearchWithFields(query string, fields []string) ([]*Issue, error)
 
 	params := map[string]string{
 		"jql":           query,
-		"validateQuery": "true",
+		"validateQuery": strconv.FormatBool(j.validate),
 		"fields":        useFields,
+		"startAt":       strconv.Itoa(startAt),
 		"maxResults":    max,
 	}
 
@@ -90,7 +132,7 @@ func (j *Jira) SearchWithFields(query string, fields []string) ([]*Issue, error)
 		return nil, uerr
 	}
 
-	return issueList.Issues, nil
+	return &issueList, nil
 }
 
 // Issue loads the jira data for a single jira issue key, with the specified issue fields if the fields param is set
@@ -184,7 +226,10 @@ func (j *Jira) execRequest(method, aURL string, params map[string]interface{}) (
 	}
 
 	req.Header.Add("Content-Type", "application/json")
-	req.SetBasicAuth(j.auth.Username, j.auth.Password)
+	if aerr := j.auth.Apply(req); aerr != nil {
+		fmt.Println("auth error: ", aerr)
+		return nil, aerr
+	}
 
 	resp, rerr := j.client.Do(req)
 	if rerr != nil {
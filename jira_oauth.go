@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Atlassian three-legged OAuth 2.0 (authorization code grant) endpoints
+const (
+	atlassianAuthURL      = "https://auth.atlassian.com/authorize"
+	atlassianTokenURL     = "https://auth.atlassian.com/oauth/token"
+	atlassianResourcesURL = "https://api.atlassian.com/oauth/token/accessible-resources"
+	atlassianAPIURL       = "https://api.atlassian.com/ex/jira/"
+	atlassianScopes       = "read:jira-work write:jira-work offline_access"
+)
+
+// jiraOAuth holds OAuth 2.0 tokens of a single JIRA Cloud site,
+// they are stored in ~/.j2i/oauth/jira-<site host>.json and refreshed when expired
+type jiraOAuth struct {
+	oauth2Token
+	file    string
+	SiteURL string
+	CloudID string
+}
+
+// accessibleResource is a site the OAuth token grants access to
+type accessibleResource struct {
+	ID   string `json:"id"`
+	URL  string `json:"url"`
+	Name string `json:"name"`
+}
+
+func newJiraOAuth(cfg *appConfig, siteURL string) (*jiraOAuth, error) {
+	u, err := url.Parse(siteURL)
+	if err != nil {
+		return nil, err
+	}
+	return &jiraOAuth{
+		oauth2Token: oauth2Token{
+			tokenURL:     atlassianTokenURL,
+			clientID:     cfg.JiraOAuthClientID,
+			clientSecret: cfg.JiraOAuthSecret,
+		},
+		file:    oauthFile("jira-" + u.Host),
+		SiteURL: strings.TrimRight(siteURL, "/"),
+	}, nil
+}
+
+// load reads stored tokens, j2i authorize jira stores them first
+func (o *jiraOAuth) load() error {
+	err := loadJSON(o.file, o)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("no JIRA OAuth tokens for %s - run: j2i authorize jira", o.SiteURL)
+	}
+	return err
+}
+
+// apiURL is the base URL JIRA REST API is reachable on with OAuth tokens
+func (o *jiraOAuth) apiURL() string {
+	return atlassianAPIURL + o.CloudID
+}
+
+// accessToken returns access token refreshing it when it's about to expire,
+// it's used as Auth.TokenSource
+func (o *jiraOAuth) accessToken() (string, error) {
+	if o.AccessToken == "" {
+		if err := o.load(); err != nil {
+			return "", err
+		}
+	}
+	if !o.expired() {
+		return o.AccessToken, nil
+	}
+	if c.trace {
+		fmt.Printf("jiraOAuth: refreshing access token for %s\n", o.SiteURL)
+	}
+	if err := o.refresh(); err != nil {
+		return "", fmt.Errorf("refresh of JIRA OAuth token failed (%v) - run: j2i authorize jira", err)
+	}
+	return o.AccessToken, saveJSON(o.file, o)
+}
+
+// findCloudID looks up cloud ID of SiteURL among sites the token has access to
+func (o *jiraOAuth) findCloudID() error {
+	req, err := http.NewRequest(mGet, atlassianResourcesURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+o.AccessToken)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(resp.Status)
+	}
+
+	var sites []accessibleResource
+	if err := json.NewDecoder(resp.Body).Decode(&sites); err != nil {
+		return err
+	}
+	for _, s := range sites {
+		if strings.TrimRight(s.URL, "/") == o.SiteURL {
+			o.CloudID = s.ID
+			return nil
+		}
+	}
+	return fmt.Errorf("OAuth token has no access to %s", o.SiteURL)
+}
+
+// authorizeJira walks through the authorization code grant and stores the tokens
+func (c *appContext) authorizeJira() error {
+	if c.cfg.JiraOAuthClientID == "" || c.cfg.JiraOAuthSecret == "" || c.cfg.JiraOAuthRedirect == "" {
+		return errors.New("JiraOAuthClientID, JiraOAuthSecret and JiraOAuthRedirect must be set in config")
+	}
+	o, err := newJiraOAuth(c.cfg, c.cc.JiraBaseURL)
+	if err != nil {
+		return err
+	}
+
+	q := url.Values{
+		"audience": {"api.atlassian.com"},
+		"scope":    {atlassianScopes},
+		"prompt":   {"consent"},
+	}
+	if err := o.authorize(atlassianAuthURL, q, c.cfg.JiraOAuthRedirect, o.SiteURL); err != nil {
+		return err
+	}
+	if err := o.findCloudID(); err != nil {
+		return err
+	}
+	if err := saveJSON(o.file, o); err != nil {
+		return err
+	}
+	fmt.Printf("\tAuthorized %s (cloud ID: %s), tokens saved to %s\n", o.SiteURL, o.CloudID, o.file)
+	return nil
+}
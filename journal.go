@@ -0,0 +1,227 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Run statuses
+const (
+	runRunning = "running" // a run that never got to the end failed - resume it
+	runDone    = "done"
+	runRolling = "rolling back" // rollback started, its run is never resumed
+	runRolled  = "rolled back"
+)
+
+// runJournal records every change a billing run made in FreshBooks and JIRA,
+// it's saved to ~/.j2i/runs/<ID>.json after each of them so that a failed run
+// can be resumed where it stopped
+type runJournal struct {
+	file         string
+	ID           string // <client>-<start time>
+	Client       string
+	Args         []string // command line flags of the run
+	From         string   // billing period of the run
+	To           string
+	Started      time.Time
+	Status       string
+	Command      string         // command of the run, empty for billing runs
+	Pushed       []TimeEntry    // time entries created, updated or found pushed before
+	Changed      []TimeEntry    // time entries reconcile fix changed, as they were
+	Deleted      []TimeEntry    // time entries reconcile fix deleted
+	Billed       []billedChange // changes of the billed ledger
+	Invoice      string         // invoice number
+	PDF          string         // where invoice PDF was saved
+	Transitioned []string       // issue keys
+	Labeled      []string       // issue keys
+	Sent         string         // when the invoice was emailed
+}
+
+func journalFile(id string) string {
+	return filepath.Join(j2iDir(), "runs", id+".json")
+}
+
+// newJournal starts journal of the run
+func (c *appContext) newJournal() *runJournal {
+	now := time.Now()
+	id := fmt.Sprintf("%s-%s", c.client, now.Format("20060102-150405"))
+	j := &runJournal{
+		file:    journalFile(id),
+		ID:      id,
+		Client:  c.client,
+		Args:    os.Args[1:],
+		Started: now,
+		Status:  runRunning,
+	}
+	if !c.period.From.IsZero() {
+		j.From = c.period.From.Format(dayFormat)
+	}
+	if !c.period.To.IsZero() {
+		j.To = c.period.To.Format(dayFormat)
+	}
+	j.record(func(*runJournal) {})
+	if c.dryRun {
+		fmt.Printf("\tRun journal: none (-dryRun saves nothing)\n")
+	} else {
+		fmt.Printf("\tRun journal: %s\n", j.file)
+	}
+	return j
+}
+
+// loadJournal reads journal of run id
+func loadJournal(id string) (*runJournal, error) {
+	j := &runJournal{file: journalFile(id)}
+	err := loadJSON(j.file, j)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no run %s", id)
+	}
+	return j, err
+}
+
+// journals returns journals of client's runs (all runs without client), latest first
+func journals(client string) ([]*runJournal, error) {
+	files, err := ioutil.ReadDir(filepath.Join(j2iDir(), "runs"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, f := range files {
+		if strings.HasSuffix(f.Name(), ".json") && strings.HasPrefix(f.Name(), client) {
+			names = append(names, strings.TrimSuffix(f.Name(), ".json"))
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+
+	var all []*runJournal
+	for _, id := range names {
+		j, err := loadJournal(id)
+		if err != nil {
+			return nil, err
+		}
+		if client == "" || j.Client == client {
+			all = append(all, j)
+		}
+	}
+	return all, nil
+}
+
+// resumeJournal loads journal of the run to resume - run id or the latest
+// failed run of -client, and parses the flags of that run again
+func resumeJournal(args []string) *runJournal {
+	j, err := findResumable(args)
+	if _, ok := err.(usageError); ok {
+		fmt.Fprintf(os.Stderr, "j2i: %v\n", err)
+		os.Exit(exitUsage)
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "j2i: %v\n", err)
+		os.Exit(exitFailed)
+	}
+
+	// the same period even if thisMonth is next month by now
+	runArgs := append([]string{}, j.Args...)
+	if j.From != "" {
+		runArgs = append(runArgs, "-from", j.From)
+	}
+	if j.To != "" {
+		runArgs = append(runArgs, "-to", j.To)
+	}
+	if err := flag.CommandLine.Parse(runArgs); err != nil {
+		os.Exit(exitUsage)
+	}
+	fmt.Printf("\tResuming run %s started %s\n", j.ID, j.Started.Format(time.RFC1123))
+	return j
+}
+
+func findResumable(args []string) (*runJournal, error) {
+	switch len(args) {
+	case 0:
+		if *client == "" {
+			return nil, usageError("usage: j2i -client CODE resume | j2i resume RUN-ID")
+		}
+		all, err := journals(*client)
+		if err != nil {
+			return nil, err
+		}
+		for _, j := range all {
+			if j.Status == runRunning && j.Command == "" {
+				return j, nil
+			}
+		}
+		return nil, fmt.Errorf("no failed run of %s to resume", *client)
+	case 1:
+		j, err := loadJournal(args[0])
+		if err != nil {
+			return nil, err
+		}
+		if j.Status != runRunning {
+			return nil, fmt.Errorf("run %s is %s", j.ID, j.Status)
+		}
+		if j.Command != "" {
+			return nil, fmt.Errorf("run %s is %s, it can't be resumed - j2i rollback %s", j.ID, j.Command, j.ID)
+		}
+		return j, nil
+	}
+	return nil, usageError("usage: j2i -client CODE resume | j2i resume RUN-ID")
+}
+
+// record applies change to the journal and saves it right away
+func (j *runJournal) record(change func(j *runJournal)) {
+	change(j)
+	if c.dryRun {
+		return
+	}
+	if err := saveJSON(j.file, j); err != nil {
+		fmt.Fprintf(os.Stderr, "j2i: can't write run journal! %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// pushed records time entry and ledger changes billing it, entries are recorded once
+func (j *runJournal) pushed(te TimeEntry, changes []billedChange) {
+	j.record(func(j *runJournal) {
+		j.Billed = append(j.Billed, changes...)
+		for i, v := range j.Pushed {
+			if v.TimeEntryID == te.TimeEntryID {
+				j.Pushed[i] = te
+				return
+			}
+		}
+		j.Pushed = append(j.Pushed, te)
+	})
+}
+
+func (j *runJournal) transitioned(key string) bool {
+	return hasKey(j.Transitioned, key)
+}
+
+func (j *runJournal) labeled(key string) bool {
+	return hasKey(j.Labeled, key)
+}
+
+func hasKey(keys []string, key string) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// removeKey returns keys without key
+func removeKey(keys []string, key string) []string {
+	var rest []string
+	for _, k := range keys {
+		if k != key {
+			rest = append(rest, k)
+		}
+	}
+	return rest
+}
@@ -2,72 +2,56 @@
 package main
 
 import (
-	"encoding/json"
 	"flag"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"os"
-	"os/user"
-	"path/filepath"
 	"time"
 )
 
 var (
-	client    = flag.String("client", "", "Client CODE from ~/.j2i/config.json - maps to JIRA Search Filter ID")
-	fbProject = flag.String("fbProject", "", "Fresh Books Project Name")
-	fbTask    = flag.String("fbTask", "", "Fresh Books Task")
+	client    = flag.String("client", "", "Client CODE from ~/.j2i/config.json - selects client settings (JIRA Search Filter ID or JQL, FreshBooks project/task ...)")
+	fbProject = flag.String("fbProject", "", "Fresh Books Project Name (overrides client config)")
+	fbTask    = flag.String("fbTask", "", "Fresh Books Task (overrides client config)")
 	doFB      = flag.Bool("doFB", true, "Do a push to FreshBooks")
 	doJIRA    = flag.Bool("doJIRA", true, "Do an update back to JIRA")
+	source    = flag.String("source", sourceJQL, "Where JIRA issues come from: jql (paginated REST search) or feed (XML RSS feed, max 1000 issues)")
+	in        = flag.String("in", "", "Read JIRA issues from saved XML feed or JSON search export (- for stdin) instead of JIRA")
+	from      = flag.String("from", "", "Bill time logged on or after YYYY-MM-DD")
+	to        = flag.String("to", "", "Bill time logged on or before YYYY-MM-DD")
+	per       = flag.String("period", "", "Billing period: thisMonth or lastMonth (-from/-to override its bounds)")
+	entries   = flag.String("entries", "", "Time entry per: issue (due date), worklog or day (issue/author/day rollup of worklogs) (default day)")
+	rollupBy  = flag.String("rollup", "", "Sub-task/epic rollup: none, parent (sub-task time on parent's line) or epic (sections per epic) (default none)")
 	trace     = flag.Bool("trace", false, "Trace flag")
+	send      = flag.Bool("send", false, "Email the invoice to the client at the end of the run (after a confirmation)")
+	dryRun    = flag.Bool("dryRun", false, "Run everything but print requests that would change JIRA or FreshBooks instead of sending them, reads and OAuth token refresh are printed and still sent")
+	invoiceNo = flag.String("invoice", "", "Invoice number JIRA issues are labeled with when j2i doesn't create the invoice (no Invoice Num prompt)")
+	yes       = flag.Bool("yes", false, "Answer yes to every confirmation (prompts are skipped and answered no when stdin is not a terminal)")
+	onFailure = flag.String("onFailure", failStop, "When a time entry or JIRA issue update fails: stop (resume the run later), continue (past it, exit code 4) or rollback (undo the run)")
 )
 
-type appConfig struct {
-	JiraAccountName     string            // Account name (i.e. hashjoin - appended to .atlassian.net XML feed for items)
-	JiraUname           string            // Username (i.e. admin, not email address)
-	JiraPass            string            // Password
-	JiraInvoicedTransID string            // Transition ID set on invoiced issues (for example Done=11 on our JIRA Cloud Instance)
-	JiraInvoicedPrefix  string            // Invoiced issues are labled with JiraInvoicedPrefix+FB-Invoice#
-	ClientSearchIDs     map[string]string // Client Code to JIRA Search Filter ID mapping
-	FbAccountName       string
-	FbAuthToken         string // Token-Based authentication (deprecated)
-	FbConsumerKey       string // OAuth authentication
-	FbConsumerSecret    string // OAuth authentication
-	FbOAuthToken        string // OAuth authentication
-	FbOAuthTokenSecret  string // OAuth authentication
-}
-
 type appContext struct {
 	client     string
 	trace      bool
 	doFB       bool
 	doJIRA     bool
+	dryRun     bool
+	yes        bool
+	onFailure  string
+	entries    string
+	rollup     string
+	period     period
 	reportOnly bool
 	cfg        *appConfig
+	cc         *clientConfig
+	oauth      *jiraOAuth
+	journal    *runJournal     // journal of the billing run
+	failedKeys map[string]bool // issues of time entries -onFailure continue went past
+	exit       int             // exit code of the run
 }
 
 var c *appContext
 
-func loadConfig() *appConfig {
-	usr, err := user.Current()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "j2i: %v\n", err)
-		os.Exit(1)
-	}
-
-	cfgFile := filepath.Join(usr.HomeDir, ".j2i/config.json")
-	file, e := ioutil.ReadFile(cfgFile)
-	if e != nil {
-		fmt.Fprintf(os.Stderr, "Unable to load %s", cfgFile)
-		os.Exit(1)
-	}
-	var config appConfig
-	if err := json.Unmarshal(file, &config); err != nil {
-		fmt.Fprintf(os.Stderr, "Unable to unmarshal %s", cfgFile)
-		os.Exit(1)
-	}
-	return &config
-}
-
 func (c *appContext) printFB(i interface{}, err error) {
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "j2i: %v\n", err)
@@ -79,7 +63,7 @@ func (c *appContext) printFB(i interface{}, err error) {
 }
 
 func (c *appContext) helpFB() {
-	fb := NewAPI(c.cfg.FbAccountName, c.cfg.FbAuthToken)
+	fb := c.newBooks()
 	c.printFB(fb.Clients())
 	c.printFB(fb.Projects())
 	c.printFB(fb.Tasks())
@@ -98,64 +82,98 @@ func (c *appContext) helpFB() {
 }
 
 func main() {
-	cfg := loadConfig()
+	flag.Usage = usage
 	flag.Parse()
+	args := flag.Args()
+	var journal *runJournal
+	if len(args) > 0 && args[0] == "resume" {
+		journal = resumeJournal(args[1:])
+		args = nil
+	}
+	cfg := loadConfig(*in != "")
+	cc := cfg.clientConfig(*client)
+	cc.FbProject = firstSet(*fbProject, cc.FbProject)
+	cc.FbTask = firstSet(*fbTask, cc.FbTask)
 	c = &appContext{
-		client: *client,
-		trace:  *trace,
-		doFB:   *doFB,
-		doJIRA: *doJIRA,
-		cfg:    cfg,
+		client:     *client,
+		trace:      *trace,
+		doFB:       *doFB,
+		doJIRA:     *doJIRA,
+		dryRun:     *dryRun,
+		yes:        *yes,
+		onFailure:  *onFailure,
+		failedKeys: make(map[string]bool),
+		entries:    firstSet(*entries, cc.Entries),
+		rollup:     firstSet(*rollupBy, cc.Rollup),
+		cfg:        cfg,
+		cc:         cc,
+		journal:    journal,
 	}
 
-	if *fbProject == "" || *fbTask == "" {
+	if !validFailurePolicy(c.onFailure) {
+		fmt.Fprintf(os.Stderr, "j2i: unknown -onFailure policy: %s\n", c.onFailure)
+		os.Exit(exitUsage)
+	}
+	if c.dryRun {
+		httpClient = newDryRunClient()
+	}
+
+	if c.runCommand(args) {
+		return
+	}
+
+	if cc.FbProject == "" || (cc.FbTask == "" && len(cc.Tasks) == 0) {
 		c.reportOnly = true
 	}
 
-	if *client == "" {
+	if *in != "" {
+		// offline - nothing to update back in JIRA, and without
+		// a client there is no billed ledger to push against
+		c.doJIRA = false
+		if *client == "" {
+			c.reportOnly = true
+		}
+	}
+
+	if *client == "" && *in == "" {
 		c.helpFB()
 		fmt.Printf("If you only want to see JIRA report - omit fbProject or fbTask or both\n\n")
 		flag.Usage()
-		os.Exit(1)
-	}
-
-	var err error
-	url := fmt.Sprintf("https://%s.atlassian.net/sr/jira.issueviews:searchrequest-xml/%s/SearchRequest-%s.xml?tempMax=1000&field=key&field=summary&field=timespent&field=due&os_authType=basic", c.cfg.JiraAccountName, c.cfg.ClientSearchIDs[*client], c.cfg.ClientSearchIDs[*client])
-	x, err := c.downloadItems(url)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "j2i: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitUsage)
 	}
-	allItems := parseXML(x)
 
-	// fmt.Printf("%#v", allItems)
-	var totTime float64
-	for i, v := range allItems {
-		//                                     Mon, 4 Apr 2016 00:00:00 -0700
-		allItems[i].DueDate, err = time.Parse("Mon, 2 Jan 2006 15:04:05 -0700", v.Due)
-
-		if c.trace {
-			fmt.Printf("%#v\n", v.Due)
-			fmt.Printf("%#v\n", allItems[i].DueDate)
-		}
+	allItems, allEntries, ledger := c.billing()
 
+	var out io.Writer = os.Stdout
+	if cc.ReportDir != "" {
+		f, err := c.reportFile()
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "j2i: %v\n", err)
 			os.Exit(1)
 		}
-		// %-70s - pads Summary to 70 chars
-		fmt.Printf("%v   %s: %-70s%.2f\n", allItems[i].DueDate.Format("2006-Jan-02"), v.Key.Val, v.Summary, float64(v.TimeSpent.Seconds)/60/60)
-		totTime += float64(v.TimeSpent.Seconds) / 60 / 60
+		defer f.Close()
+		out = io.MultiWriter(os.Stdout, f)
 	}
-	fmt.Printf("%96s\n", "-----")
-	fmt.Printf("%90s: %.2f\n", "Total Hours", totTime)
+	c.report(out, allEntries)
 
 	if c.reportOnly {
 		os.Exit(0)
 	}
 
-	var fb *API
-	fb = NewAPI(c.cfg.FbAccountName, c.cfg.FbAuthToken)
+	// resumed run has nothing pending, what it pushed is billed already
+	if c.journal == nil && len(allEntries.pending()) == 0 {
+		fmt.Printf("\nNothing to bill\n")
+		os.Exit(exitOK)
+	}
+
+	if c.journal == nil {
+		c.journal = c.newJournal()
+	}
+	invoice := firstSet(c.journal.Invoice, *invoiceNo)
+	if c.journal.Invoice == "" && invoice != "" {
+		c.journal.record(func(j *runJournal) { j.Invoice = invoice })
+	}
+	fb := c.newBooks()
 
 	if c.doFB {
 		c.printFB(fb.Clients())
@@ -163,15 +181,159 @@ func main() {
 		c.printFB(fb.Tasks())
 		c.printFB(fb.Users())
 
-		fmt.Printf("\n%87s: %.2f\n", "Task Total", totTime*fb.findTaskRate(*fbTask))
+		project, err := fb.resolveProject(cc.FbClient, cc.FbProject)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "j2i: %v\n", err)
+			os.Exit(1)
+		}
+		tasks, err := fb.resolveTasks(project, allEntries.pending().taskNames())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "j2i: %v\n", err)
+			os.Exit(1)
+		}
+
+		if authors := fb.unmatchedAuthors(allEntries); len(authors) > 0 {
+			fmt.Fprintf(os.Stderr, "j2i: no FreshBooks staff for JIRA authors (map them in FbStaff):\n")
+			for _, author := range authors {
+				fmt.Fprintf(os.Stderr, "\t%s\n", author)
+			}
+			os.Exit(1)
+		}
+
+		c.taskReport(out, allEntries.pending(), fb.findTaskRate)
 
 		fmt.Printf("---> FreshBooks.Start\n")
-		fb.pushFB(allItems, *fbProject, *fbTask)
+		fb.pushFB(allEntries, project, tasks, ledger)
+		if invoice == "" {
+			// time entries pushed before a resumed run failed are billed too
+			invoice, err = fb.createInvoice(c.journal.Pushed, project)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "j2i: can't create invoice (%v) - create it in FreshBooks\n", err)
+			} else {
+				c.journal.record(func(j *runJournal) { j.Invoice = invoice })
+			}
+		}
 		fmt.Printf("<--- FreshBooks.End\n")
 	}
 
+	approved := true
 	if c.doJIRA {
-		c.updateItems(allItems, fb)
+		invoice, approved = c.updateItems(c.billedItems(allItems, allEntries), fb, invoice)
+	}
+
+	if approved && (*send || cc.SendInvoice) && invoice != "" {
+		if err := c.sendInvoice(out, fb, invoice); err != nil {
+			c.failed(fmt.Errorf("can't send invoice %s! %v", invoice, err))
+		}
+	}
+
+	if c.exit != exitOK {
+		c.resumeHint()
+		os.Exit(c.exit)
+	}
+	c.journal.record(func(j *runJournal) { j.Status = runDone })
+}
+
+// billing loads JIRA items of the billing period and splits them into Entries
+// with time billed on previous runs applied
+func (c *appContext) billing() (Items, Entries, *billedLedger) {
+	cc := c.cc
+	if !validEntryMode(c.entries) {
+		fmt.Fprintf(os.Stderr, "j2i: unknown -entries mode: %s\n", c.entries)
+		os.Exit(exitUsage)
+	}
+
+	if !validRollup(c.rollup) {
+		fmt.Fprintf(os.Stderr, "j2i: unknown -rollup mode: %s\n", c.rollup)
+		os.Exit(exitUsage)
+	}
+
+	if *in == "" && *source != sourceJQL && *source != sourceFeed {
+		fmt.Fprintf(os.Stderr, "j2i: unknown -source: %s\n", *source)
+		os.Exit(exitUsage)
+	}
+	if *in == "" && *source == sourceFeed && cc.SearchID == "" {
+		fmt.Fprintf(os.Stderr, "j2i: -source=%s needs SearchID in client config\n", sourceFeed)
+		os.Exit(exitUsage)
+	}
+
+	if err := validDateSources(cc.DateSources); err != nil {
+		fmt.Fprintf(os.Stderr, "j2i: %v\n", err)
+		os.Exit(exitUsage)
+	}
+
+	var err error
+	c.period, err = newPeriod(firstSet(*per, cc.Period), firstSet(*from, cc.From), firstSet(*to, cc.To), time.Now())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "j2i: %v\n", err)
+		os.Exit(exitUsage)
+	}
+
+	var allItems Items
+	var jql string
+	switch {
+	case *in != "":
+		allItems, err = readItems(*in)
+	case *source == sourceJQL:
+		if jql, err = cc.jql(); err == nil {
+			allItems, err = c.searchItems(c.period.query(jql))
+		}
+	case *source == sourceFeed:
+		allItems, err = c.feedItems(cc.SearchID)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "j2i: %v\n", err)
+		os.Exit(1)
+	}
+
+	// worklogs are needed to split time by day or to trim it to the period
+	if (c.entries != entryIssue || !c.period.open()) && *in == "" {
+		if err := c.fetchWorklogs(allItems, c.newJira()); err != nil {
+			fmt.Fprintf(os.Stderr, "j2i: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// fmt.Printf("%#v", allItems)
+	run := time.Now()
+	for i, v := range allItems {
+		allItems[i].Date, allItems[i].DateSrc = itemDate(v, cc.DateSources, run)
+		allItems[i].Task = cc.taskFor(v)
+
+		if c.trace {
+			fmt.Printf("%#v\n", v.Due)
+			fmt.Printf("%s: %#v\n", allItems[i].DateSrc, allItems[i].Date)
+		}
+	}
+
+	// billed time recorded before worklogs were tracked is consumed from the
+	// oldest worklogs, so the ledger goes on before trimming drops them
+	ledger, err := loadLedger(c.client)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "j2i: %v\n", err)
+		os.Exit(1)
+	}
+	ledger.apply(allItems)
+	allItems = c.period.trim(allItems)
+
+	if c.rollup != rollupNone {
+		if *in == "" {
+			err = c.fetchLinks(allItems)
+		} else {
+			fillLinks(allItems, allItems.byKey())
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "j2i: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	allEntries := rollup(buildEntries(allItems, c.entries), allItems, c.rollup, c.entries)
+
+	// billed ledger keeps time as logged, only FreshBooks gets it rounded
+	for i, e := range allEntries {
+		allEntries[i].Rounded = cc.Rounding.apply(e.Seconds)
 	}
 
+	return allItems, allEntries, ledger
 }
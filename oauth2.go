@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// oauth2Token is OAuth 2.0 (authorization code grant) token pair, types embedding it
+// store it along with whatever else they need under ~/.j2i/oauth
+type oauth2Token struct {
+	tokenURL     string
+	clientID     string
+	clientSecret string
+	AccessToken  string
+	RefreshToken string
+	Expiry       time.Time
+}
+
+// tokenResponse is OAuth 2.0 token endpoint response
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+	Error        string `json:"error"`
+	Description  string `json:"error_description"`
+}
+
+// expired is true when access token is about to expire
+func (o *oauth2Token) expired() bool {
+	return !time.Now().Add(time.Minute).Before(o.Expiry)
+}
+
+// token calls token endpoint with grant params and keeps the tokens it returns
+func (o *oauth2Token) token(grant map[string]string) error {
+	grant["client_id"] = o.clientID
+	grant["client_secret"] = o.clientSecret
+	b, err := json.Marshal(grant)
+	if err != nil {
+		return err
+	}
+
+	resp, err := httpClient.Post(o.tokenURL, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	tr := tokenResponse{}
+	if err := json.Unmarshal(data, &tr); err != nil {
+		return fmt.Errorf("%s: %v", resp.Status, err)
+	}
+	if resp.StatusCode != http.StatusOK || tr.AccessToken == "" {
+		return fmt.Errorf("%s: %s %s", resp.Status, tr.Error, tr.Description)
+	}
+
+	o.AccessToken = tr.AccessToken
+	if tr.RefreshToken != "" {
+		// refresh tokens rotate
+		o.RefreshToken = tr.RefreshToken
+	}
+	o.Expiry = time.Now().Add(time.Duration(tr.ExpiresIn) * time.Second)
+	return nil
+}
+
+// refresh gets new access token with the refresh token
+func (o *oauth2Token) refresh() error {
+	return o.token(map[string]string{
+		"grant_type":    "refresh_token",
+		"refresh_token": o.RefreshToken,
+	})
+}
+
+// authorize sends user to authURL, reads back the URL they were
+// redirected to and exchanges the code it carries for tokens
+func (o *oauth2Token) authorize(authURL string, q url.Values, redirect, what string) error {
+	state := strconv.FormatInt(time.Now().UnixNano(), 36)
+	q.Set("client_id", o.clientID)
+	q.Set("redirect_uri", redirect)
+	q.Set("response_type", "code")
+	q.Set("state", state)
+	if !interactive() {
+		return errors.New("authorize needs a terminal to paste the redirect URL into")
+	}
+	line := ask(fmt.Sprintf("\n\tOpen the URL below, grant access to %s\n\tand paste the URL you were redirected to\n\n\t%s?%s\n\n\tRedirected to: ", what, authURL, q.Encode()))
+	code, err := authCode(line, state)
+	if err != nil {
+		return err
+	}
+
+	return o.token(map[string]string{
+		"grant_type":   "authorization_code",
+		"code":         code,
+		"redirect_uri": redirect,
+	})
+}
+
+// authCode extracts authorization code from redirect URL (or takes the bare code)
+func authCode(redirected, state string) (string, error) {
+	if !strings.Contains(redirected, "?") {
+		if redirected == "" {
+			return "", errors.New("no authorization code")
+		}
+		return redirected, nil
+	}
+	u, err := url.Parse(redirected)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	if e := q.Get("error"); e != "" {
+		return "", fmt.Errorf("authorization failed: %s %s", e, q.Get("error_description"))
+	}
+	if q.Get("state") != state {
+		return "", errors.New("authorization state does not match - start over")
+	}
+	if q.Get("code") == "" {
+		return "", errors.New("no authorization code in " + redirected)
+	}
+	return q.Get("code"), nil
+}
+
+// oauthFile returns path of stored tokens named name
+func oauthFile(name string) string {
+	return filepath.Join(j2iDir(), "oauth", name+".json")
+}
+
+func loadJSON(file string, v interface{}) error {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func saveJSON(file string, v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, b, 0600)
+}
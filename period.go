@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const dayFormat = "2006-01-02"
+
+// period bounds billing to time logged between From and To (both days inclusive),
+// zero From or To leaves that side open
+type period struct {
+	From time.Time
+	To   time.Time
+}
+
+// newPeriod builds period out of -period keyword (thisMonth, lastMonth)
+// and/or explicit -from / -to days, explicit days win over the keyword
+func newPeriod(keyword, from, to string, now time.Time) (period, error) {
+	var p period
+	first := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	switch keyword {
+	case "":
+	case "thisMonth":
+		p.From, p.To = first, first.AddDate(0, 1, -1)
+	case "lastMonth":
+		p.From, p.To = first.AddDate(0, -1, 0), first.AddDate(0, 0, -1)
+	default:
+		return p, fmt.Errorf("unknown period: %s (thisMonth or lastMonth)", keyword)
+	}
+
+	var err error
+	if from != "" {
+		if p.From, err = time.Parse(dayFormat, from); err != nil {
+			return p, fmt.Errorf("bad -from: %v", err)
+		}
+	}
+	if to != "" {
+		if p.To, err = time.Parse(dayFormat, to); err != nil {
+			return p, fmt.Errorf("bad -to: %v", err)
+		}
+	}
+	if !p.From.IsZero() && !p.To.IsZero() && p.To.Before(p.From) {
+		return p, fmt.Errorf("period ends (%s) before it starts (%s)", to, from)
+	}
+	return p, nil
+}
+
+func (p period) open() bool {
+	return p.From.IsZero() && p.To.IsZero()
+}
+
+// contains compares days only - worklogs keep the timezone they were logged in
+func (p period) contains(t time.Time) bool {
+	day := t.Format(dayFormat)
+	if !p.From.IsZero() && day < p.From.Format(dayFormat) {
+		return false
+	}
+	if !p.To.IsZero() && day > p.To.Format(dayFormat) {
+		return false
+	}
+	return true
+}
+
+// clamp moves t into the period
+func (p period) clamp(t time.Time) time.Time {
+	if !p.From.IsZero() && t.Format(dayFormat) < p.From.Format(dayFormat) {
+		return p.From
+	}
+	if !p.To.IsZero() && t.Format(dayFormat) > p.To.Format(dayFormat) {
+		return p.To
+	}
+	return t
+}
+
+func (p period) String() string {
+	if p.open() {
+		return "all unbilled time"
+	}
+	from, to := "...", "..."
+	if !p.From.IsZero() {
+		from = p.From.Format(dayFormat)
+	}
+	if !p.To.IsZero() {
+		to = p.To.Format(dayFormat)
+	}
+	return from + " - " + to
+}
+
+// jql narrows down JIRA search to issues with work logged in the period
+func (p period) jql() string {
+	var q string
+	if !p.From.IsZero() {
+		q += fmt.Sprintf(` AND worklogDate >= "%s"`, p.From.Format(dayFormat))
+	}
+	if !p.To.IsZero() {
+		q += fmt.Sprintf(` AND worklogDate <= "%s"`, p.To.Format(dayFormat))
+	}
+	return q
+}
+
+// orderByRe finds ORDER BY clause of JIRA query
+var orderByRe = regexp.MustCompile(`(?i)\border\s+by\b`)
+
+// query narrows down JIRA query jql to the period, jql goes in parentheses
+// so its ORs keep their meaning and its ORDER BY is moved to the end
+func (p period) query(jql string) string {
+	where, order := jql, ""
+	if all := orderByRe.FindAllStringIndex(jql, -1); len(all) > 0 {
+		at := all[len(all)-1][0]
+		where, order = jql[:at], " "+strings.TrimSpace(jql[at:])
+	}
+	if where = strings.TrimSpace(where); where != "" {
+		where = "(" + where + ")"
+	}
+	return strings.TrimSpace(strings.TrimPrefix(where+p.jql(), " AND ") + order)
+}
+
+// trim keeps only time logged inside the period: worklogs outside of it
+// are dropped, issue level time is kept when the issue date falls in it
+func (p period) trim(allItems Items) Items {
+	if p.open() {
+		return allItems
+	}
+	var kept Items
+	for _, v := range allItems {
+		if len(v.Worklogs) == 0 {
+			if p.contains(v.Date) {
+				kept = append(kept, v)
+			}
+			continue
+		}
+
+		var in []ItemWorklog
+		for _, w := range v.Worklogs {
+			if p.contains(w.Started) {
+				in = append(in, w)
+			}
+		}
+		if len(in) == 0 {
+			continue
+		}
+		v.Worklogs = in
+		v.Date = p.clamp(v.Date)
+		kept = append(kept, v)
+	}
+	return kept
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestNewPeriod(t *testing.T) {
+	now := day("2026-03-15")
+	tests := []struct {
+		keyword, from, to string
+		want              string // From - To, empty when it fails
+	}{
+		{"", "", "", "all unbilled time"},
+		{"thisMonth", "", "", "2026-03-01 - 2026-03-31"},
+		{"lastMonth", "", "", "2026-02-01 - 2026-02-28"},
+		{"lastMonth", "2026-02-10", "", "2026-02-10 - 2026-02-28"},
+		{"", "2026-01-01", "", "2026-01-01 - ..."},
+		{"", "", "2026-01-31", "... - 2026-01-31"},
+		{"nextMonth", "", "", ""},
+		{"", "2026-13-01", "", ""},
+		{"", "2026-02-01", "2026-01-01", ""},
+	}
+	for _, tt := range tests {
+		p, err := newPeriod(tt.keyword, tt.from, tt.to, now)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("%q %q %q: %v, want an error", tt.keyword, tt.from, tt.to, p)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q %q %q: %v", tt.keyword, tt.from, tt.to, err)
+			continue
+		}
+		if got := p.String(); got != tt.want {
+			t.Errorf("%q %q %q: %s, want %s", tt.keyword, tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestPeriodTrim(t *testing.T) {
+	april := period{From: day("2026-04-01"), To: day("2026-04-30")}
+	noLogs := Item{Key: ItemKey{Val: "ALU-2"}, Date: day("2026-04-10")}
+	march := Item{Key: ItemKey{Val: "ALU-3"}, Date: day("2026-03-10")}
+
+	tests := []struct {
+		name string
+		p    period
+		item Item
+		logs int    // worklogs kept, -1 - the item is dropped
+		date string // Date of the kept item
+	}{
+		{"open", period{}, ledgerItem("ALU-1"), 3, ""},
+		{"worklogs in and out", april, ledgerItem("ALU-1"), 1, "2026-04-01"},
+		{"worklogs out", period{To: day("2026-02-28")}, ledgerItem("ALU-1"), -1, ""},
+		{"issue in", april, noLogs, 0, "2026-04-10"},
+		{"issue out", april, march, -1, ""},
+	}
+	for _, tt := range tests {
+		item := tt.item
+		if item.Date.IsZero() {
+			item.Date = day("2026-03-01")
+		}
+		kept := tt.p.trim(Items{item})
+		if tt.logs < 0 {
+			if len(kept) != 0 {
+				t.Errorf("%s: kept %+v", tt.name, kept)
+			}
+			continue
+		}
+		if len(kept) != 1 {
+			t.Errorf("%s: dropped", tt.name)
+			continue
+		}
+		if len(kept[0].Worklogs) != tt.logs {
+			t.Errorf("%s: kept %d worklogs, want %d", tt.name, len(kept[0].Worklogs), tt.logs)
+		}
+		if got := kept[0].Date.Format(dayFormat); tt.date != "" && got != tt.date {
+			t.Errorf("%s: dated %s, want %s", tt.name, got, tt.date)
+		}
+	}
+}
+
+// issue billed as a whole before worklogs were tracked consumes its oldest
+// worklogs - including the ones outside of the period
+func TestLedgerBeforeTrim(t *testing.T) {
+	item := Item{
+		Key:  ItemKey{Val: "ALU-1"},
+		Date: day("2026-04-30"),
+		Worklogs: []ItemWorklog{
+			worklog("1", "ann", "2026-03-02", 6),
+			worklog("2", "ann", "2026-03-09", 4),
+			worklog("3", "ann", "2026-04-06", 5),
+		},
+	}
+	l := &billedLedger{Issues: map[string]*billedIssue{"ALU-1": {Seconds: 10 * 3600}}}
+	april := period{From: day("2026-04-01"), To: day("2026-04-30")}
+
+	allItems := Items{item}
+	l.apply(allItems)
+	allEntries := buildEntries(april.trim(allItems), entryIssue)
+	if len(allEntries) != 1 || allEntries[0].Hours() != 5 {
+		t.Errorf("%+v, want a single entry of 5 hours", allEntries)
+	}
+}
+
+func TestPeriodQuery(t *testing.T) {
+	april := period{From: day("2026-04-01"), To: day("2026-04-30")}
+	in := ` AND worklogDate >= "2026-04-01" AND worklogDate <= "2026-04-30"`
+	tests := []struct {
+		p    period
+		jql  string
+		want string
+	}{
+		{period{}, "filter=10100", "(filter=10100)"},
+		{april, "filter=10100", "(filter=10100)" + in},
+		{april, "project = ALU OR project = NOK", "(project = ALU OR project = NOK)" + in},
+		{april, "project = ALU ORDER BY created", "(project = ALU)" + in + " ORDER BY created"},
+		{april, "project = ALU order by created DESC", "(project = ALU)" + in + " order by created DESC"},
+		{april, "ORDER BY key", in[len(" AND "):] + " ORDER BY key"},
+		{period{}, "project = ALU ORDER BY key", "(project = ALU) ORDER BY key"},
+	}
+	for _, tt := range tests {
+		if got := tt.p.query(tt.jql); got != tt.want {
+			t.Errorf("%q: %q, want %q", tt.jql, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Exit codes
+const (
+	exitOK       = 0
+	exitFailed   = 1 // the run stopped (resume it) or was rolled back, see -onFailure
+	exitUsage    = 2 // bad flags or command
+	exitDeclined = 3 // a confirmation was declined or skipped - resume the run with -yes
+	exitPartial  = 4 // -onFailure continue went past failures or issues couldn't be transitioned
+)
+
+// usageError is a command used the wrong way, it exits with exitUsage
+type usageError string
+
+func (e usageError) Error() string {
+	return string(e)
+}
+
+// Failure policies of -onFailure
+const (
+	failStop     = "stop"
+	failContinue = "continue"
+	failRollback = "rollback"
+)
+
+func validFailurePolicy(policy string) bool {
+	switch policy {
+	case failStop, failContinue, failRollback:
+		return true
+	}
+	return false
+}
+
+// stdin is shared by the prompts so that none of them loses buffered input
+var stdin = bufio.NewReader(os.Stdin)
+
+// interactive is true when stdin is a terminal someone can answer prompts on
+func interactive() bool {
+	fi, err := os.Stdin.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// confirm asks y/n question, -yes answers it and without a terminal it's
+// skipped, anything but yes sets exitDeclined
+func (c *appContext) confirm(question string) bool {
+	fmt.Printf("%s [y|n]: ", question)
+	switch {
+	case c.yes:
+		fmt.Printf("y (-yes)\n")
+		return true
+	case !interactive():
+		fmt.Printf("n (stdin is not a terminal, see -yes)\n")
+		c.exitWith(exitDeclined)
+		return false
+	}
+	ok, _ := stdin.ReadString('\n')
+	if strings.HasPrefix(strings.ToLower(ok), "y") {
+		return true
+	}
+	c.exitWith(exitDeclined)
+	return false
+}
+
+// ask reads answer to question, without a terminal there is none
+func ask(question string) string {
+	fmt.Print(question)
+	if !interactive() {
+		fmt.Printf("(stdin is not a terminal)\n")
+		return ""
+	}
+	answer, _ := stdin.ReadString('\n')
+	return strings.TrimSpace(answer)
+}
+
+// exitWith sets exit code of the run, the worst code wins
+func (c *appContext) exitWith(code int) {
+	if code > c.exit {
+		c.exit = code
+	}
+}
+
+// failed handles failure of a single time entry or issue update according
+// to -onFailure, it only returns when the run should go on
+func (c *appContext) failed(err error) {
+	fmt.Fprintf(os.Stderr, "j2i: %v\n", err)
+	switch c.onFailure {
+	case failContinue:
+		c.exitWith(exitPartial)
+		return
+	case failRollback:
+		fmt.Fprintf(os.Stderr, "j2i: rolling back run %s\n", c.journal.ID)
+		if err := c.undoRun(c.journal); err != nil {
+			fmt.Fprintf(os.Stderr, "j2i: rollback failed! %v - j2i rollback %s\n", err, c.journal.ID)
+		}
+	default:
+		c.resumeHint()
+	}
+	os.Exit(exitFailed)
+}
+
+// resumeHint tells how to finish the run
+func (c *appContext) resumeHint() {
+	if !c.dryRun {
+		fmt.Fprintf(os.Stderr, "j2i: run %s is not finished - j2i resume %s\n", c.journal.ID, c.journal.ID)
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+)
+
+// provision creates FreshBooks client, project and tasks of the client config
+// that are missing in FreshBooks and assigns tasks and staff to the project,
+// what exists is left alone so it's safe to re-run
+func (c *appContext) provision() error {
+	cc := c.cc
+	if c.client == "" || cc.FbClient == "" || cc.FbProject == "" {
+		return usageError("usage: j2i -client CODE provision (FbClient and FbProject must be set in client config)")
+	}
+	fb := c.newBooks()
+	c.printFB(fb.Clients())
+	c.printFB(fb.Projects())
+	c.printFB(fb.Tasks())
+	c.printFB(fb.Users())
+
+	clientID, err := fb.provisionClient(cc.FbClient)
+	if err != nil {
+		return err
+	}
+
+	var taskIDs, userIDs []int
+	for _, name := range cc.taskNames() {
+		id, err := fb.provisionTask(name, cc.FbTaskRates[name])
+		if err != nil {
+			return err
+		}
+		taskIDs = append(taskIDs, id)
+	}
+	for _, email := range cc.FbProjectStaff {
+		id := fb.findUser(email)
+		if id == 0 {
+			return fmt.Errorf("no FreshBooks staff with email: %s - invite them first", email)
+		}
+		userIDs = append(userIDs, id)
+	}
+
+	return fb.provisionProject(cc.FbProject, clientID, taskIDs, userIDs, c.cfg.FbAPI == fbREST)
+}
+
+// taskNames returns FbTask and tasks of task rules
+func (cc *clientConfig) taskNames() []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, name := range append([]string{cc.FbTask}, ruleTasks(cc.Tasks)...) {
+		if name != "" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func ruleTasks(rules []taskRule) []string {
+	var names []string
+	for _, r := range rules {
+		names = append(names, r.Task)
+	}
+	return names
+}
+
+func (a *fbooks) provisionClient(name string) (int, error) {
+	var ids []int
+	for _, v := range a.clients {
+		if v.Name == name {
+			ids = append(ids, v.ClientID)
+		}
+	}
+	switch len(ids) {
+	case 0:
+		id, err := a.CreateClient(&Client{Name: name})
+		if err != nil {
+			return 0, err
+		}
+		a.clients = append(a.clients, Client{ClientID: id, Name: name})
+		fmt.Printf("\tCreated Client: %s ID:%d\n", name, id)
+		return id, nil
+	case 1:
+		fmt.Printf("\tClient exists: %s ID:%d\n", name, ids[0])
+		return ids[0], nil
+	}
+	return 0, fmt.Errorf("client %q is ambiguous, there are %d clients named so", name, len(ids))
+}
+
+func (a *fbooks) provisionTask(name string, rate float64) (int, error) {
+	var tasks []Task
+	for _, v := range a.tasks {
+		if v.Name == name {
+			tasks = append(tasks, v)
+		}
+	}
+	switch len(tasks) {
+	case 0:
+		task := Task{Name: name, Rate: rate}
+		id, err := a.CreateTask(&task)
+		if err != nil {
+			return 0, err
+		}
+		task.TaskID = id
+		a.tasks = append(a.tasks, task)
+		fmt.Printf("\tCreated Task: %s ID:%d Rate:%.2f\n", name, id, rate)
+		return id, nil
+	case 1:
+		if rate != 0 && tasks[0].Rate != rate {
+			fmt.Printf("\tTask exists: %s ID:%d (its rate %.2f is not FbTaskRates %.2f)\n", name, tasks[0].TaskID, tasks[0].Rate, rate)
+		} else {
+			fmt.Printf("\tTask exists: %s ID:%d\n", name, tasks[0].TaskID)
+		}
+		return tasks[0].TaskID, nil
+	}
+	return 0, fmt.Errorf("task %q is ambiguous, there are %d tasks named so", name, len(tasks))
+}
+
+// provisionProject creates project of client or adds tasks and staff it misses,
+// noStaff backends can't assign staff - missing staff is only reported
+func (a *fbooks) provisionProject(name string, clientID int, taskIDs, userIDs []int, noStaff bool) error {
+	var projects []Project
+	for _, v := range a.projects {
+		if v.Name == name && v.ClientID == clientID {
+			projects = append(projects, v)
+		}
+	}
+	if len(projects) > 1 {
+		return fmt.Errorf("project %q is ambiguous, client has %d projects named so", name, len(projects))
+	}
+
+	if len(projects) == 0 {
+		pr := Project{Name: name, ClientID: clientID, TaskIDs: taskIDs, UserIDs: userIDs}
+		if noStaff {
+			pr.UserIDs = nil
+		}
+		id, err := a.CreateProject(&pr)
+		if err != nil {
+			return err
+		}
+		pr.ProjectID = id
+		fmt.Printf("\tCreated Project: %s ID:%d\n", name, id)
+		if noStaff {
+			// services are assigned by update
+			if err := a.UpdateProject(&pr); err != nil {
+				return err
+			}
+			a.reportStaff(userIDs)
+		}
+		return nil
+	}
+
+	pr := projects[0]
+	addTasks := missingIDs(pr.TaskIDs, taskIDs)
+	addUsers := missingIDs(pr.UserIDs, userIDs)
+	if noStaff {
+		a.reportStaff(addUsers)
+		addUsers = nil
+	}
+	if len(addTasks) == 0 && len(addUsers) == 0 {
+		fmt.Printf("\tProject exists: %s ID:%d\n", name, pr.ProjectID)
+		return nil
+	}
+	pr.TaskIDs = append(pr.TaskIDs, addTasks...)
+	pr.UserIDs = append(pr.UserIDs, addUsers...)
+	if err := a.UpdateProject(&pr); err != nil {
+		return err
+	}
+	fmt.Printf("\tUpdated Project: %s ID:%d (added %d tasks, %d staff)\n", name, pr.ProjectID, len(addTasks), len(addUsers))
+	return nil
+}
+
+// reportStaff lists staff to be assigned to the project in FreshBooks
+func (a *fbooks) reportStaff(userIDs []int) {
+	for _, id := range userIDs {
+		for _, u := range a.users {
+			if u.UserID == id {
+				fmt.Printf("\tAssign %s to the project in FreshBooks\n", u.Email)
+			}
+		}
+	}
+}
+
+// missingIDs returns ids that are not in have
+func missingIDs(have, ids []int) []int {
+	var missing []int
+	for _, id := range ids {
+		found := false
+		for _, h := range have {
+			if h == id {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, id)
+		}
+	}
+	return missing
+}
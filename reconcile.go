@@ -0,0 +1,303 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Reconcile statuses of an issue
+const (
+	recOK         = "ok"
+	recNotPushed  = "not pushed yet"        // unbilled JIRA time - next run pushes it
+	recMissing    = "missing in FreshBooks" // billed time with no time entries
+	recMismatch   = "hours mismatch"        // time entries don't add up to billed time
+	recLowered    = "worklogs lowered"      // JIRA time went down after it was billed
+	recOrphan     = "orphan"                // j2i time entry of an issue j2i has no record of
+	recNotInJIRA  = "not in JIRA search"    // billed issue the JIRA search no longer returns
+	recNotFromJ2I = "not from JIRA"         // time entry without j2i marker
+)
+
+// reconciled is JIRA and FreshBooks side of a single issue (Entry key)
+type reconciled struct {
+	Key     string
+	Status  string
+	Billed  float64 // hours billed according to the ledger
+	Logged  float64 // hours logged in JIRA
+	Booked  float64 // hours of FreshBooks time entries
+	Entries Entries
+	Booking []TimeEntry
+}
+
+// reconcile compares FreshBooks time entries of the project with JIRA items
+// of the billing period, with fix it makes FreshBooks match what was billed
+func (c *appContext) reconcile(args []string) error {
+	fix := len(args) == 1 && args[0] == "fix"
+	if len(args) > 1 || (len(args) == 1 && !fix) || c.client == "" || c.cc.FbProject == "" {
+		return usageError("usage: j2i -client CODE [-period|-from|-to] reconcile [fix]")
+	}
+
+	allItems, allEntries, ledger := c.billing()
+	fb := c.newBooks()
+	c.printFB(fb.Clients())
+	c.printFB(fb.Projects())
+	c.printFB(fb.Tasks())
+	c.printFB(fb.Users())
+	project, err := fb.resolveProject(c.cc.FbClient, c.cc.FbProject)
+	if err != nil {
+		return err
+	}
+
+	from, to := c.period.From, c.period.To
+	for _, e := range allEntries {
+		if from.IsZero() || e.Date.Before(from) {
+			from = e.Date
+		}
+	}
+	if from.IsZero() {
+		from = time.Now()
+	}
+	if to.IsZero() {
+		to = time.Now()
+	}
+	booked, err := fb.TimeEntries(project.ProjectID, from.Format(dayFormat), to.Format(dayFormat))
+	if err != nil {
+		return err
+	}
+
+	recs, unmarked := c.reconciled(allItems, allEntries, booked, ledger)
+	fmt.Printf("\nReconcile: %s %s - %s\n\n", project.Name, from.Format(dayFormat), to.Format(dayFormat))
+	fmt.Printf("%-14s %-22s%10s%10s%10s\n", "Issue", "Status", "Billed", "FreshBks", "Logged")
+	problems := 0
+	for _, r := range recs {
+		if r.Status == recOK {
+			continue
+		}
+		problems++
+		fmt.Printf("%-14s %-22s%10.2f%10.2f%10.2f\n", r.Key, r.Status, r.Billed, r.Booked, r.Logged)
+	}
+	for _, te := range unmarked {
+		problems++
+		fmt.Printf("%-14s %-22s%10s%10.2f%10s  %s ID:%d %s\n", "", recNotFromJ2I, "", te.Hours, "", te.Date, te.TimeEntryID, te.Notes)
+	}
+	fmt.Printf("\n%d issues, %d to look at\n", len(recs), problems)
+
+	if !fix {
+		return nil
+	}
+	fixes, err := fb.reconcileFixes(recs, project)
+	if err != nil {
+		return err
+	}
+	return c.fixReconciled(fb, fixes)
+}
+
+// reconciled pairs Entries with time entries by issue key of their marker,
+// time entries without marker are returned apart
+func (c *appContext) reconciled(allItems Items, allEntries Entries, booked []TimeEntry, ledger *billedLedger) ([]*reconciled, []TimeEntry) {
+	byKey := make(map[string]*reconciled)
+	rec := func(key string) *reconciled {
+		r, ok := byKey[key]
+		if !ok {
+			r = &reconciled{Key: key}
+			byKey[key] = r
+		}
+		return r
+	}
+
+	items := allItems.byKey()
+	for _, e := range allEntries {
+		r := rec(e.Key)
+		r.Entries = append(r.Entries, e)
+		r.Billed += e.BilledHours()
+		for _, p := range e.parts() {
+			r.Logged += loggedHours(p, items[p.Key])
+		}
+	}
+
+	var unmarked []TimeEntry
+	for _, te := range booked {
+		m := markerRe.FindString(te.Notes)
+		if m == "" {
+			unmarked = append(unmarked, te)
+			continue
+		}
+		// [j2i:KEY:hash]
+		r := rec(strings.Split(strings.Trim(m, "[]"), ":")[1])
+		r.Booking = append(r.Booking, te)
+		r.Booked += te.Hours
+	}
+
+	var recs []*reconciled
+	for _, r := range byKey {
+		tolerance := c.cc.Rounding.tolerance() * float64(len(r.Booking))
+		switch {
+		case len(r.Entries) == 0:
+			if _, ok := ledger.Issues[r.Key]; ok {
+				r.Status = recNotInJIRA
+			} else {
+				r.Status = recOrphan
+			}
+		case r.Logged < r.Billed-tolerance:
+			r.Status = recLowered
+		case len(r.Booking) == 0 && r.Billed > 0:
+			r.Status = recMissing
+		case math.Abs(r.Booked-r.Billed) > tolerance:
+			r.Status = recMismatch
+		case r.Logged > r.Billed+tolerance:
+			r.Status = recNotPushed
+		default:
+			r.Status = recOK
+		}
+		recs = append(recs, r)
+	}
+	sort.Slice(recs, func(i, j int) bool { return recs[i].Key < recs[j].Key })
+	return recs, unmarked
+}
+
+// loggedHours returns hours logged in JIRA for the part of the issue Entry holds
+func loggedHours(e Entry, it Item) float64 {
+	var seconds int64
+	for _, s := range e.Worklogs {
+		seconds += s
+	}
+	if len(e.Worklogs) == 0 {
+		seconds = it.TimeSpent.Seconds
+	}
+	return float64(seconds) / 60 / 60
+}
+
+// tolerance is how far (hours) a rounded time entry may be from the time it bills
+func (r rounding) tolerance() float64 {
+	minutes := r.Increment
+	if r.Minimum > minutes {
+		minutes = r.Minimum
+	}
+	return math.Max(float64(minutes)/60, 0.01)
+}
+
+// Reconcile fix operations
+const (
+	fixCreate = "Create"
+	fixUpdate = "Update"
+	fixDelete = "Delete"
+)
+
+// reconcileFix is a single change reconcile fix makes in FreshBooks
+type reconcileFix struct {
+	Key   string
+	Op    string
+	Entry TimeEntry // entry to create, entry with new hours or entry to delete
+	Was   TimeEntry // updated entry as it was
+}
+
+// reconcileFixes plans how to make FreshBooks match billed time: missing entries
+// are created, the last entry of mismatched issue takes the difference and
+// orphans are deleted
+func (a *fbooks) reconcileFixes(recs []*reconciled, project Project) ([]reconcileFix, error) {
+	var fixes []reconcileFix
+	for _, r := range recs {
+		switch r.Status {
+		case recMissing:
+			for _, e := range r.Entries {
+				if e.Billed == 0 {
+					continue
+				}
+				task, err := a.resolveTask(project, e.Task)
+				if err != nil {
+					return nil, err
+				}
+				userID, ok := a.findStaff(e)
+				if !ok {
+					return nil, fmt.Errorf("%s: no FreshBooks staff for %s", e.Key, e.Author)
+				}
+				fixes = append(fixes, reconcileFix{Key: r.Key, Op: fixCreate, Entry: TimeEntry{
+					ProjectID: project.ProjectID,
+					TaskID:    task.TaskID,
+					UserID:    userID,
+					Date:      e.Date.Format(dayFormat),
+					Notes:     e.description() + " " + e.restoredMarker(),
+					Hours:     e.BilledHours(),
+				}})
+			}
+
+		case recMismatch:
+			te := r.Booking[len(r.Booking)-1]
+			hours := te.Hours + r.Billed - r.Booked
+			if hours <= 0 {
+				fmt.Fprintf(os.Stderr, "\t%s: can't take %.2f hours off Time Entry ID:%d - fix it in FreshBooks\n", r.Key, r.Booked-r.Billed, te.TimeEntryID)
+				continue
+			}
+			fix := reconcileFix{Key: r.Key, Op: fixUpdate, Entry: te, Was: te}
+			fix.Entry.Hours = hours
+			fixes = append(fixes, fix)
+
+		case recOrphan:
+			for _, te := range r.Booking {
+				fixes = append(fixes, reconcileFix{Key: r.Key, Op: fixDelete, Entry: te})
+			}
+
+		case recLowered, recNotInJIRA:
+			fmt.Printf("\t%s: %s - fix it by hand\n", r.Key, r.Status)
+		}
+	}
+	return fixes, nil
+}
+
+// fixReconciled applies fixes once they are confirmed, every change is journaled
+// so that j2i rollback undoes it
+func (c *appContext) fixReconciled(a *fbooks, fixes []reconcileFix) error {
+	if len(fixes) == 0 {
+		fmt.Printf("\nNothing to fix\n")
+		return nil
+	}
+	fmt.Printf("\nFix:\n")
+	for _, f := range fixes {
+		fmt.Printf("\t%s: %s Time Entry: ID:%d %s Hours:%.2f", f.Key, f.Op, f.Entry.TimeEntryID, f.Entry.Date, f.Entry.Hours)
+		if f.Op == fixUpdate {
+			fmt.Printf(" (was %.2f)", f.Was.Hours)
+		}
+		fmt.Printf("\n")
+	}
+	if !c.dryRun && !c.confirm("\n\tFix FreshBooks?") {
+		return nil
+	}
+
+	c.journal = c.newJournal()
+	c.journal.record(func(j *runJournal) { j.Command = "reconcile fix" })
+	fmt.Printf("---> FreshBooks.Fix\n")
+	for _, f := range fixes {
+		te := f.Entry
+		switch f.Op {
+		case fixCreate:
+			id, err := a.SaveTimeEntry(&te)
+			if err != nil {
+				return err
+			}
+			te.TimeEntryID = id
+			c.journal.record(func(j *runJournal) { j.Pushed = append(j.Pushed, te) })
+			fmt.Printf("\t%s: Created Time Entry: ID:%d Hours:%.2f\n", f.Key, id, te.Hours)
+		case fixUpdate:
+			if _, err := a.SaveTimeEntry(&te); err != nil {
+				return err
+			}
+			c.journal.record(func(j *runJournal) { j.Changed = append(j.Changed, f.Was) })
+			fmt.Printf("\t%s: Updated Time Entry: ID:%d Hours:%.2f\n", f.Key, te.TimeEntryID, te.Hours)
+		case fixDelete:
+			if err := a.DeleteTimeEntry(te.TimeEntryID); err != nil {
+				return err
+			}
+			c.journal.record(func(j *runJournal) { j.Deleted = append(j.Deleted, te) })
+			fmt.Printf("\t%s: Deleted Time Entry: ID:%d Hours:%.2f\n", f.Key, te.TimeEntryID, te.Hours)
+		}
+	}
+	fmt.Printf("<--- FreshBooks.Fix\n")
+	c.journal.record(func(j *runJournal) { j.Status = runDone })
+	if !c.dryRun {
+		fmt.Printf("\nUndo it with: j2i rollback %s\n", c.journal.ID)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func booked(key string, hours float64) TimeEntry {
+	return TimeEntry{Hours: hours, Notes: fmt.Sprintf("%s: work [j2i:%s:0badf00d]", key, key)}
+}
+
+func TestReconciled(t *testing.T) {
+	saved := c
+	defer func() { c = saved }()
+	c = &appContext{cc: &clientConfig{}}
+
+	h := int64(3600)
+	allEntries := Entries{
+		{Key: "ALU-1", Billed: h, Worklogs: map[string]int64{"1": h}},
+		{Key: "ALU-2", Billed: h, Seconds: h / 2, Worklogs: map[string]int64{"2": h, "3": h / 2}},
+		{Key: "ALU-3", Billed: h, Worklogs: map[string]int64{"4": h}},
+		{Key: "ALU-4", Billed: 2 * h, Worklogs: map[string]int64{"5": 2 * h}},
+		{Key: "ALU-5", Billed: 2 * h, Worklogs: map[string]int64{"6": h}},
+		{Key: "ALU-8", Seconds: h, Worklogs: map[string]int64{"7": h}},
+	}
+	entries := []TimeEntry{
+		booked("ALU-1", 1),
+		booked("ALU-2", 1),
+		booked("ALU-4", 1),
+		booked("ALU-4", 0.5),
+		booked("ALU-5", 2),
+		booked("ALU-6", 1),
+		booked("ALU-7", 1),
+		{Hours: 3, Notes: "typed in FreshBooks"},
+	}
+	ledger := &billedLedger{Issues: map[string]*billedIssue{"ALU-7": {Seconds: h}}}
+
+	recs, unmarked := c.reconciled(nil, allEntries, entries, ledger)
+	got := make(map[string]string)
+	for _, r := range recs {
+		got[r.Key] = r.Status
+	}
+	want := map[string]string{
+		"ALU-1": recOK,
+		"ALU-2": recNotPushed,
+		"ALU-3": recMissing,
+		"ALU-4": recMismatch,
+		"ALU-5": recLowered,
+		"ALU-6": recOrphan,
+		"ALU-7": recNotInJIRA,
+		"ALU-8": recNotPushed,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("%v, want %v", got, want)
+	}
+	if len(unmarked) != 1 || unmarked[0].Hours != 3 {
+		t.Errorf("unmarked %+v", unmarked)
+	}
+}
+
+func TestRoundingTolerance(t *testing.T) {
+	tests := []struct {
+		r    rounding
+		want float64
+	}{
+		{rounding{}, 0.01},
+		{rounding{Increment: 15}, 0.25},
+		{rounding{Increment: 6, Minimum: 30}, 0.5},
+	}
+	for _, tt := range tests {
+		if got := tt.r.tolerance(); got != tt.want {
+			t.Errorf("%+v: %v, want %v", tt.r, got, tt.want)
+		}
+	}
+}
+
+// books keeps time entries in memory, other calls of Books are not expected
+type books struct {
+	Books
+	entries []TimeEntry
+}
+
+func (b *books) SaveTimeEntry(te *TimeEntry) (int, error) {
+	for i, v := range b.entries {
+		if v.TimeEntryID == te.TimeEntryID {
+			b.entries[i] = *te
+			return te.TimeEntryID, nil
+		}
+	}
+	id := len(b.entries) + 1
+	b.entries = append(b.entries, *te)
+	b.entries[id-1].TimeEntryID = id
+	return id, nil
+}
+
+func (b *books) TimeEntries(projectID int, from, to string) ([]TimeEntry, error) {
+	return b.entries, nil
+}
+
+// time entry reconcile fix put back stays when time of the same issue is pushed later
+func TestFixThenPush(t *testing.T) {
+	saved := c
+	defer func() { c = saved }()
+	c = &appContext{dryRun: true, cc: &clientConfig{}, failedKeys: make(map[string]bool)}
+
+	b := &books{}
+	fb := &fbooks{Books: b, staff: map[string]string{"ann": "ann@alu.com"},
+		users: []User{{UserID: 7, Email: "ann@alu.com"}}, tasks: []Task{{TaskID: 3, Name: "Dev"}}}
+	project := Project{ProjectID: 1, TaskIDs: []int{3}}
+	e := Entry{Key: "ALU-1", Summary: "research", Date: day("2026-04-01"), Author: "ann", Task: "Dev",
+		Seconds: 1800, Rounded: 1800, Billed: 3600, Worklogs: map[string]int64{"1": 3600, "2": 1800}}
+
+	fixes, err := fb.reconcileFixes([]*reconciled{{Key: "ALU-1", Status: recMissing, Entries: Entries{e}}}, project)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.fixReconciled(fb, fixes); err != nil {
+		t.Fatal(err)
+	}
+	c.journal = &runJournal{}
+	fb.pushFB(Entries{e}, project, map[string]Task{"Dev": fb.tasks[0]}, &billedLedger{Issues: make(map[string]*billedIssue)})
+
+	var hours []float64
+	for _, te := range b.entries {
+		hours = append(hours, te.Hours)
+	}
+	if !reflect.DeepEqual(hours, []float64{1, 0.5}) {
+		t.Errorf("time entries of %v hours, want [1 0.5]", hours)
+	}
+}
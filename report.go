@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// report prints Entries with billed, unbilled and total hours to w,
+// with epic rollup entries are in sections with subtotals per epic,
+// returns total of unbilled hours
+func (c *appContext) report(w io.Writer, allEntries Entries) float64 {
+	var totBilled, totTime, secBilled, secTime float64
+	fmt.Fprintf(w, "Period: %s\n\n", c.period)
+	fmt.Fprintf(w, "%-11s %-8s  %-77s%10s%10s%10s\n", "Date", "Source", "Issue", "Billed", "Unbilled", "Total")
+	for i, e := range allEntries {
+		if c.rollup == rollupEpic && (i == 0 || e.Epic.Key != allEntries[i-1].Epic.Key) {
+			if e.Epic.Key == "" {
+				fmt.Fprintf(w, "\n--- No Epic ---\n")
+			} else {
+				fmt.Fprintf(w, "\n--- %s: %s ---\n", e.Epic.Key, e.Epic.Summary)
+			}
+		}
+
+		summary := e.Summary
+		if len(e.Subtasks) > 0 {
+			summary += " (" + strings.Join(e.Subtasks, ", ") + ")"
+		}
+		// %-70s - pads Summary to 70 chars
+		fmt.Fprintf(w, "%v %-8s  %s: %-70s%10.2f%10.2f%10.2f\n", e.Date.Format("2006-Jan-02"), e.DateSrc, e.Key, summary, e.BilledHours(), e.Hours(), e.BilledHours()+e.Hours())
+		totBilled += e.BilledHours()
+		totTime += e.Hours()
+		secBilled += e.BilledHours()
+		secTime += e.Hours()
+
+		if c.rollup == rollupEpic && (i == len(allEntries)-1 || e.Epic.Key != allEntries[i+1].Epic.Key) {
+			fmt.Fprintf(w, "%97s: %10.2f%10.2f%10.2f\n", "Subtotal", secBilled, secTime, secBilled+secTime)
+			secBilled, secTime = 0, 0
+		}
+	}
+	fmt.Fprintf(w, "%129s\n", "-----")
+	fmt.Fprintf(w, "%97s: %10.2f%10.2f%10.2f\n", "Total Hours", totBilled, totTime, totBilled+totTime)
+	return totTime
+}
+
+// reportFile creates <ReportDir>/<client>-<run time>.txt to save the report to
+func (c *appContext) reportFile() (*os.File, error) {
+	if err := os.MkdirAll(c.cc.ReportDir, 0755); err != nil {
+		return nil, err
+	}
+	name := fmt.Sprintf("%s-%s.txt", c.client, time.Now().Format("20060102-150405"))
+	return os.Create(filepath.Join(c.cc.ReportDir, name))
+}
+
+// taskReport prints unbilled hours, rate and amount per FreshBooks task to w,
+// returns total amount
+func (c *appContext) taskReport(w io.Writer, allEntries Entries, rate func(task string) float64) float64 {
+	var totAmount float64
+	fmt.Fprintf(w, "\n%97s  %10s%10s%10s\n", "Task", "Unbilled", "Rate", "Amount")
+	for _, task := range allEntries.taskNames() {
+		var hours float64
+		for _, e := range allEntries {
+			if e.Task == task {
+				hours += e.Hours()
+			}
+		}
+		amount := hours * rate(task)
+		totAmount += amount
+		fmt.Fprintf(w, "%97s: %10.2f%10.2f%10.2f\n", task, hours, rate(task), amount)
+	}
+	fmt.Fprintf(w, "%129s\n", "-----")
+	fmt.Fprintf(w, "%97s: %30.2f\n", "Task Total", totAmount)
+	return totAmount
+}
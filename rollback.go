@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// rollback undoes billing run given by its ID or invoice number: deletes time
+// entries it pushed, takes them off the billed ledger, removes invoice label
+// from its issues and moves them back to ReverseStatus, time entries changed
+// or deleted by reconcile fix are restored, every step is
+// recorded in the run journal so a failed rollback can be run again
+func (c *appContext) rollback(args []string) error {
+	if len(args) != 1 {
+		return usageError("usage: j2i [-client CODE] rollback RUN-ID|INVOICE")
+	}
+	j, err := c.findRun(args[0])
+	if err != nil {
+		return err
+	}
+	if j.Status == runRolled {
+		return fmt.Errorf("run %s is %s", j.ID, j.Status)
+	}
+	if c.client == "" {
+		c.client, c.cc = j.Client, c.cfg.clientConfig(j.Client)
+	} else if c.client != j.Client {
+		return fmt.Errorf("run %s bills %s not %s", j.ID, j.Client, c.client)
+	}
+	c.journal = j
+
+	label := c.invoiceLabel(j)
+	fmt.Printf("\n\tRun %s started %s is about to be rolled back:\n", j.ID, j.Started.Format(dayFormat))
+	fmt.Printf("\t%d time entries deleted, %d restored, %d issues unlabeled (%s), %d issues moved back\n",
+		len(j.Pushed), len(j.Changed)+len(j.Deleted), len(j.Labeled), label, len(j.Transitioned))
+	if !c.dryRun && !c.confirm("\n\tRoll back?") {
+		return nil
+	}
+	return c.undoRun(j)
+}
+
+// undoRun rolls back run of journal j
+func (c *appContext) undoRun(j *runJournal) error {
+	label := c.invoiceLabel(j)
+	j.record(func(r *runJournal) { r.Status = runRolling })
+	if len(j.Pushed) > 0 || len(j.Changed) > 0 || len(j.Deleted) > 0 {
+		fb := c.newBooks()
+		fmt.Printf("---> FreshBooks.Rollback\n")
+		for len(j.Pushed) > 0 {
+			te := j.Pushed[0]
+			if err := fb.DeleteTimeEntry(te.TimeEntryID); err != nil {
+				return err
+			}
+			fmt.Printf("\tDeleted Time Entry: ID:%d Hours:%.2f\n", te.TimeEntryID, te.Hours)
+			j.record(func(r *runJournal) { r.Pushed = r.Pushed[1:] })
+		}
+		for len(j.Changed) > 0 {
+			te := j.Changed[0]
+			if _, err := fb.SaveTimeEntry(&te); err != nil {
+				return err
+			}
+			fmt.Printf("\tRestored Time Entry: ID:%d Hours:%.2f\n", te.TimeEntryID, te.Hours)
+			j.record(func(r *runJournal) { r.Changed = r.Changed[1:] })
+		}
+		for len(j.Deleted) > 0 {
+			te := j.Deleted[0]
+			te.TimeEntryID = 0
+			id, err := fb.SaveTimeEntry(&te)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("\tRestored Time Entry: ID:%d (was ID:%d) Hours:%.2f\n", id, j.Deleted[0].TimeEntryID, te.Hours)
+			j.record(func(r *runJournal) { r.Deleted = r.Deleted[1:] })
+		}
+		fmt.Printf("<--- FreshBooks.Rollback\n")
+	}
+
+	if len(j.Billed) > 0 {
+		ledger, err := loadLedger(j.Client)
+		if err != nil {
+			return err
+		}
+		if err := ledger.undo(j.Billed); err != nil {
+			return fmt.Errorf("can't record billed time! %v", err)
+		}
+		j.record(func(r *runJournal) { r.Billed = nil })
+	}
+
+	if len(j.Labeled) > 0 || len(j.Transitioned) > 0 {
+		jira := c.newJira()
+		comment := fmt.Sprintf("invoicebot: removed label: %s (billing run %s rolled back)", label, j.ID)
+		for len(j.Labeled) > 0 {
+			key := j.Labeled[0]
+			r, err := jira.IssuesService.Unlabel(key, label, comment)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "j2i: Resp: %v\n", string(r))
+				return err
+			}
+			fmt.Printf("\tUnlabeled ISSUE:%s\n", key)
+			j.record(func(r *runJournal) { r.Labeled = r.Labeled[1:] })
+		}
+
+		status, id := c.cc.ReverseStatus, c.cc.ReverseTransID
+		if status == "" && id == "" && len(j.Transitioned) > 0 {
+			fmt.Fprintf(os.Stderr, "j2i: no ReverseStatus or ReverseTransID - %s stay where the run moved them\n", strings.Join(j.Transitioned, ", "))
+		}
+		for _, key := range j.Transitioned {
+			if status == "" && id == "" {
+				break
+			}
+			t, err := c.transitionTo(jira, key, status, id)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "j2i: ISSUE:%s can't be moved back - %v\n", key, err)
+				c.exitWith(exitPartial)
+				continue
+			}
+			if err := c.updateTrans(key, jira, t); err != nil {
+				return err
+			}
+			j.record(func(r *runJournal) { r.Transitioned = removeKey(r.Transitioned, key) })
+		}
+	}
+
+	if len(j.Transitioned) == 0 {
+		j.record(func(r *runJournal) { r.Status = runRolled })
+	}
+	if j.Invoice != "" {
+		fmt.Printf("\nInvoice %s is left in FreshBooks - delete it there\n", j.Invoice)
+	}
+	return nil
+}
+
+// invoiceLabel returns label the run set on its issues
+func (c *appContext) invoiceLabel(j *runJournal) string {
+	if j.Invoice == "" {
+		return ""
+	}
+	return c.cc.InvoicedPrefix + j.Invoice
+}
+
+// findRun returns journal of run id, or the latest run of -client (any client
+// without it) that created invoice id
+func (c *appContext) findRun(id string) (*runJournal, error) {
+	if j, err := loadJournal(id); err == nil {
+		return j, nil
+	}
+	all, err := journals(c.client)
+	if err != nil {
+		return nil, err
+	}
+	for _, j := range all {
+		if j.Invoice == id {
+			return j, nil
+		}
+	}
+	return nil, fmt.Errorf("no run or invoice %s", id)
+}
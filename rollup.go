@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Rollup modes - how sub-tasks and epics show up in the report and FreshBooks
+const (
+	rollupNone   = "none"   // every issue stands on its own
+	rollupParent = "parent" // sub-task time is billed on its parent's line
+	rollupEpic   = "epic"   // entries are grouped under their epic
+)
+
+func validRollup(mode string) bool {
+	switch mode {
+	case rollupNone, rollupParent, rollupEpic:
+		return true
+	}
+	return false
+}
+
+// fetchLinks fills in parent and epic summaries (and epics of sub-tasks)
+// looking up linked issues that are not among allItems
+func (c *appContext) fetchLinks(allItems Items) error {
+	known := allItems.byKey()
+
+	// keys that are gone or not visible to us must not fail the whole lookup
+	j := c.newJira()
+	j.validate = false
+
+	// second round picks up epics of parents found in the first one
+	for round := 0; round < 2; round++ {
+		var keys []string
+		for _, v := range known {
+			for _, k := range []string{v.Parent.Key, v.Epic.Key} {
+				if _, ok := known[k]; !ok && k != "" {
+					keys = append(keys, k)
+				}
+			}
+		}
+		if len(keys) == 0 {
+			break
+		}
+		sort.Strings(keys)
+		linked, err := c.searchWith(j, "key in ("+strings.Join(keys, ",")+")")
+		if err != nil {
+			return fmt.Errorf("parent/epic lookup: %v", err)
+		}
+		for _, v := range linked {
+			known[v.Key.Val] = v
+		}
+		for _, k := range keys {
+			if _, ok := known[k]; !ok {
+				// no access - don't look it up again
+				known[k] = Item{Key: ItemKey{Val: k}}
+			}
+		}
+	}
+
+	fillLinks(allItems, known)
+	return nil
+}
+
+// byKey maps issue key to its Item
+func (allItems Items) byKey() map[string]Item {
+	known := make(map[string]Item)
+	for _, v := range allItems {
+		known[v.Key.Val] = v
+	}
+	return known
+}
+
+// fillLinks completes parent and epic links from known issues
+func fillLinks(allItems Items, known map[string]Item) {
+	for i := range allItems {
+		v := &allItems[i]
+		if p, ok := known[v.Parent.Key]; ok && v.Parent.Key != "" {
+			if v.Parent.Summary == "" {
+				v.Parent.Summary = p.Summary
+			}
+			if v.Epic.Key == "" {
+				v.Epic = p.Epic
+			}
+		}
+		if e, ok := known[v.Epic.Key]; ok && v.Epic.Key != "" && v.Epic.Summary == "" {
+			v.Epic.Summary = e.Summary
+		}
+	}
+}
+
+// rollup applies rollup mode to Entries: sub-task entries are merged into
+// their parent's (same grouping as entry mode), or every entry gets its epic
+func rollup(allEntries Entries, allItems Items, mode, entryMode string) Entries {
+	byKey := allItems.byKey()
+
+	switch mode {
+	case rollupEpic:
+		epics := make(map[string]bool)
+		for _, v := range allItems {
+			epics[v.Epic.Key] = true
+		}
+		for i, e := range allEntries {
+			allEntries[i].Epic = byKey[e.Key].Epic
+			if epics[e.Key] {
+				// time logged on the epic itself
+				allEntries[i].Epic = ItemLink{Key: e.Key, Summary: e.Summary}
+			}
+		}
+		// entries without epic go last
+		sort.SliceStable(allEntries, func(i, j int) bool {
+			ei, ej := allEntries[i].Epic.Key, allEntries[j].Epic.Key
+			if ei == "" || ej == "" {
+				return ei != "" && ej == ""
+			}
+			return ei < ej
+		})
+		return allEntries
+
+	case rollupParent:
+		var all Entries
+		groups := make(map[string]int)
+		for _, e := range allEntries {
+			p := byKey[e.Key].Parent
+			rolled := e
+			if p.Key != "" {
+				rolled.Key, rolled.Summary = p.Key, firstSet(p.Summary, e.Summary)
+				rolled.Subtasks = []string{e.Key}
+			}
+
+			// sub-tasks billed to other tasks than their parent stay apart
+			var group string
+			switch entryMode {
+			case entryIssue:
+				group = rolled.Key + "/" + e.Task
+			case entryDay:
+				group = rolled.Key + "/" + e.Task + "/" + e.Author + "/" + e.Date.Format(dayFormat)
+			case entryWorklog:
+				rolled.Rolled = Entries{e}
+				all = append(all, rolled)
+				continue
+			}
+
+			n, ok := groups[group]
+			if !ok {
+				rolled.Worklogs = make(map[string]int64)
+				for id, s := range e.Worklogs {
+					rolled.Worklogs[id] = s
+				}
+				rolled.Rolled = Entries{e}
+				groups[group] = len(all)
+				all = append(all, rolled)
+				continue
+			}
+			all[n].Seconds += e.Seconds
+			all[n].Rounded += e.Rounded
+			all[n].Billed += e.Billed
+			all[n].Comments = append(all[n].Comments, e.Comments...)
+			for id, s := range e.Worklogs {
+				all[n].Worklogs[id] = s
+			}
+			all[n].Subtasks = append(all[n].Subtasks, rolled.Subtasks...)
+			all[n].Rolled = append(all[n].Rolled, e)
+		}
+		return all
+	}
+	return allEntries
+}
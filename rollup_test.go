@@ -0,0 +1,97 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func rollupItems() Items {
+	return Items{
+		{Key: ItemKey{Val: "ALU-1"}, Summary: "migration", Task: "Dev", Epic: ItemLink{Key: "ALU-10"},
+			Worklogs: []ItemWorklog{worklog("1", "ann", "2026-04-01", 1)}},
+		{Key: ItemKey{Val: "ALU-2"}, Summary: "scripts", Task: "Dev", Parent: ItemLink{Key: "ALU-1", Summary: "migration"},
+			Worklogs: []ItemWorklog{worklog("2", "ann", "2026-04-01", 2), worklog("3", "ann", "2026-04-02", 1)}},
+		{Key: ItemKey{Val: "ALU-3"}, Summary: "review", Task: "QA", Parent: ItemLink{Key: "ALU-1", Summary: "migration"},
+			Worklogs: []ItemWorklog{worklog("4", "ann", "2026-04-01", 1)}},
+		{Key: ItemKey{Val: "ALU-4"}, Summary: "support", Task: "Dev",
+			Worklogs: []ItemWorklog{worklog("5", "bob", "2026-04-01", 1)}},
+	}
+}
+
+// rolled is Entry as key, hours and sub-tasks
+type rolled struct {
+	Key      string
+	Hours    float64
+	Subtasks []string
+}
+
+func TestRollupParent(t *testing.T) {
+	tests := []struct {
+		entryMode string
+		want      []rolled
+	}{
+		{entryDay, []rolled{
+			{"ALU-1", 3, []string{"ALU-2"}},
+			{"ALU-1", 1, []string{"ALU-3"}}, // other task
+			{"ALU-4", 1, nil},
+			{"ALU-1", 1, []string{"ALU-2"}}, // other day
+		}},
+		{entryIssue, []rolled{
+			{"ALU-1", 4, []string{"ALU-2"}},
+			{"ALU-1", 1, []string{"ALU-3"}},
+			{"ALU-4", 1, nil},
+		}},
+		{entryWorklog, []rolled{
+			{"ALU-1", 1, nil},
+			{"ALU-1", 2, []string{"ALU-2"}},
+			{"ALU-1", 1, []string{"ALU-3"}},
+			{"ALU-4", 1, nil},
+			{"ALU-1", 1, []string{"ALU-2"}},
+		}},
+	}
+	for _, tt := range tests {
+		allItems := rollupItems()
+		var got []rolled
+		for _, e := range rollup(buildEntries(allItems, tt.entryMode), allItems, rollupParent, tt.entryMode) {
+			got = append(got, rolled{e.Key, e.Hours(), e.Subtasks})
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: %v, want %v", tt.entryMode, got, tt.want)
+		}
+	}
+}
+
+func TestRollupEpic(t *testing.T) {
+	allItems := rollupItems()
+	allItems = append(allItems, Item{Key: ItemKey{Val: "ALU-10"}, Summary: "AWS",
+		Worklogs: []ItemWorklog{worklog("6", "ann", "2026-04-03", 1)}})
+	allItems[1].Epic = ItemLink{Key: "ALU-10"}
+
+	var got [][2]string
+	for _, e := range rollup(buildEntries(allItems, entryIssue), allItems, rollupEpic, entryIssue) {
+		got = append(got, [2]string{e.Epic.Key, e.Key})
+	}
+	// entries without epic go last
+	want := [][2]string{{"ALU-10", "ALU-1"}, {"ALU-10", "ALU-2"}, {"ALU-10", "ALU-10"}, {"", "ALU-3"}, {"", "ALU-4"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("%v, want %v", got, want)
+	}
+}
+
+func TestFillLinks(t *testing.T) {
+	allItems := Items{
+		{Key: ItemKey{Val: "ALU-2"}, Parent: ItemLink{Key: "ALU-1"}},
+		{Key: ItemKey{Val: "ALU-3"}, Parent: ItemLink{Key: "ALU-9"}},
+	}
+	known := map[string]Item{
+		"ALU-1":  {Summary: "migration", Epic: ItemLink{Key: "ALU-10"}},
+		"ALU-10": {Summary: "AWS"},
+	}
+	fillLinks(allItems, known)
+	if p, e := allItems[0].Parent, allItems[0].Epic; p.Summary != "migration" || e != (ItemLink{Key: "ALU-10", Summary: "AWS"}) {
+		t.Errorf("parent %+v epic %+v", p, e)
+	}
+	if p := allItems[1].Parent; p.Summary != "" {
+		t.Errorf("unknown parent filled in: %+v", p)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// suggest returns names close to name, closest first
+func suggest(name string, names []string) []string {
+	type match struct {
+		name string
+		dist int
+	}
+	var matches []match
+	seen := make(map[string]bool)
+	lname := strings.ToLower(name)
+	for _, n := range names {
+		if seen[n] {
+			continue
+		}
+		seen[n] = true
+		ln := strings.ToLower(n)
+		d := levenshtein(lname, ln)
+		// a third of the name may differ, or one contains the other
+		if d <= (len([]rune(name))+2)/3 || (lname != "" && (strings.Contains(ln, lname) || strings.Contains(lname, ln))) {
+			matches = append(matches, match{n, d})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].dist < matches[j].dist })
+
+	var out []string
+	for i, m := range matches {
+		if i == 3 {
+			break
+		}
+		out = append(out, m.name)
+	}
+	return out
+}
+
+// levenshtein returns edit distance of a and b
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
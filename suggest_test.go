@@ -0,0 +1,43 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"abc", "", 3},
+		{"kitten", "sitting", 3},
+		{"Development", "Development", 0},
+		{"café", "cafe", 1},
+	}
+	for _, tt := range tests {
+		if got := levenshtein(tt.a, tt.b); got != tt.want {
+			t.Errorf("%q %q: %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	names := []string{"Development", "Design", "Support", "Project Management", "Development"}
+	tests := []struct {
+		name string
+		want []string
+	}{
+		{"Developement", []string{"Development"}},
+		{"development", []string{"Development"}},
+		{"management", []string{"Project Management"}},
+		{"Sup", []string{"Support"}},
+		{"Accounting", nil},
+	}
+	for _, tt := range tests {
+		if got := suggest(tt.name, names); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// taskRule bills JIRA issues matching everything it sets to a FreshBooks task
+type taskRule struct {
+	Type      string // Issue type name
+	Label     string // Label the issue has
+	Component string // Component the issue belongs to
+	Field     string // Custom field ID (customfield_10100) ...
+	Value     string // ... and its value
+	Task      string // FreshBooks Task
+}
+
+// matches is true when Item matches every condition of the rule
+func (r taskRule) matches(it Item) bool {
+	if r.Type == "" && r.Label == "" && r.Component == "" && r.Field == "" {
+		return false
+	}
+	if r.Type != "" && !strings.EqualFold(r.Type, it.Type) {
+		return false
+	}
+	if r.Label != "" && !hasValue(it.Labels, r.Label) {
+		return false
+	}
+	if r.Component != "" && !hasValue(it.Components, r.Component) {
+		return false
+	}
+	if r.Field != "" && !hasValue(it.Fields[r.Field], r.Value) {
+		return false
+	}
+	return true
+}
+
+func hasValue(vals []string, val string) bool {
+	for _, v := range vals {
+		if strings.EqualFold(v, val) {
+			return true
+		}
+	}
+	return false
+}
+
+// taskFor returns FreshBooks task of Item: the first matching rule's, FbTask otherwise
+func (cc *clientConfig) taskFor(it Item) string {
+	for _, r := range cc.Tasks {
+		if r.matches(it) {
+			return r.Task
+		}
+	}
+	return cc.FbTask
+}
+
+// taskFields returns custom fields task rules need
+func (cc *clientConfig) taskFields() []string {
+	var fields []string
+	for _, r := range cc.Tasks {
+		if r.Field != "" {
+			fields = append(fields, r.Field)
+		}
+	}
+	return fields
+}
+
+// taskNames returns FreshBooks tasks Entries are billed to in order of appearance
+func (allEntries Entries) taskNames() []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, e := range allEntries {
+		if !seen[e.Task] {
+			seen[e.Task] = true
+			names = append(names, e.Task)
+		}
+	}
+	return names
+}
+
+// pending returns Entries with time not billed yet
+func (allEntries Entries) pending() Entries {
+	var all Entries
+	for _, e := range allEntries {
+		if !e.done() {
+			all = append(all, e)
+		}
+	}
+	return all
+}
+
+// fieldValues returns JIRA REST field value as strings,
+// select lists and users come as objects, multi-value fields as arrays
+func fieldValues(v interface{}) []string {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case string:
+		return []string{v}
+	case float64, bool:
+		return []string{fmt.Sprint(v)}
+	case []interface{}:
+		var vals []string
+		for _, e := range v {
+			vals = append(vals, fieldValues(e)...)
+		}
+		return vals
+	case map[string]interface{}:
+		for _, k := range []string{"value", "name", "key", "displayName"} {
+			if s, ok := v[k].(string); ok {
+				return []string{s}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// httpClient makes every call to JIRA and FreshBooks, -dryRun swaps its transport
+var httpClient = &http.Client{}
+
+// dryRunID is the first of fake IDs returned for recorded requests
+const dryRunID = 900001
+
+// xmlMethodRe finds FreshBooks classic API method of XML request
+var xmlMethodRe = regexp.MustCompile(`method="([^"]+)"`)
+
+// recordingTransport prints every request: reads (and OAuth token refresh) are
+// sent, requests that would change something are not - they are answered with
+// fake IDs so that later steps keep going
+type recordingTransport struct {
+	next http.RoundTripper
+	id   int
+}
+
+func newDryRunClient() *http.Client {
+	return &http.Client{Transport: &recordingTransport{next: http.DefaultTransport, id: dryRunID}}
+}
+
+// RoundTrip - records write requests, sends the rest
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	if strings.HasSuffix(req.URL.Path, "/oauth/token") {
+		// body carries client secret and tokens, refreshed tokens are saved
+		// as the old ones stop working
+		fmt.Printf("DRY RUN (token refresh, sent): %s %s\n", req.Method, req.URL)
+		return t.next.RoundTrip(req)
+	}
+	if !isWrite(req, body) {
+		fmt.Printf("DRY RUN (read, sent): %s %s\n", req.Method, req.URL)
+		if len(body) > 0 {
+			fmt.Printf("%s\n", body)
+		}
+		return t.next.RoundTrip(req)
+	}
+
+	fmt.Printf("DRY RUN: %s %s\n", req.Method, req.URL)
+	if len(body) > 0 {
+		fmt.Printf("%s\n", body)
+	}
+
+	id := t.id
+	t.id++
+	resp := &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+		Request:    req,
+	}
+	var fake string
+	if xmlMethodRe.Match(body) {
+		resp.Header.Set("Content-Type", "application/xml")
+		fake = fmt.Sprintf(`<?xml version="1.0" encoding="utf-8"?>
+<response status="ok"><time_entry_id>%[1]d</time_entry_id><invoice_id>%[1]d</invoice_id><client_id>%[1]d</client_id><project_id>%[1]d</project_id><task_id>%[1]d</task_id></response>`, id)
+	} else {
+		resp.Header.Set("Content-Type", "application/json")
+		fake = fmt.Sprintf(`{"response":{"result":{"invoice":{"id":%[1]d},"client":{"id":%[1]d}}},"time_entry":{"id":%[1]d},"service":{"id":%[1]d},"project":{"id":%[1]d}}`, id)
+	}
+	resp.Body = ioutil.NopCloser(strings.NewReader(fake))
+	resp.ContentLength = int64(len(fake))
+	return resp, nil
+}
+
+// isWrite is true for requests that change something in JIRA or FreshBooks
+func isWrite(req *http.Request, body []byte) bool {
+	if req.Method == mGet || strings.HasSuffix(req.URL.Path, "/oauth/token") {
+		return false
+	}
+	if m := xmlMethodRe.FindSubmatch(body); m != nil {
+		method := string(m[1])
+		return !(strings.HasSuffix(method, ".list") || strings.HasSuffix(method, ".get") || strings.HasSuffix(method, ".getPDF"))
+	}
+	return true
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestIsWrite(t *testing.T) {
+	tests := []struct {
+		method, url, body string
+		want              bool
+	}{
+		{mGet, "https://alu.atlassian.net/rest/api/2/search", "", false},
+		{mPost, "https://auth.atlassian.com/oauth/token", "grant_type=refresh_token", false},
+		{mPost, "https://alu.freshbooks.com/api/2.1/xml-in", `<request method="time_entry.list"></request>`, false},
+		{mPost, "https://alu.freshbooks.com/api/2.1/xml-in", `<request method="invoice.get"></request>`, false},
+		{mPost, "https://alu.freshbooks.com/api/2.1/xml-in", `<request method="invoice.getPDF"></request>`, false},
+		{mPost, "https://alu.freshbooks.com/api/2.1/xml-in", `<request method="time_entry.create"></request>`, true},
+		{mPost, "https://alu.freshbooks.com/api/2.1/xml-in", `<request method="time_entry.delete"></request>`, true},
+		{mPost, "https://alu.freshbooks.com/api/2.1/xml-in", `<request method="invoice.sendByEmail"></request>`, true},
+		{mPut, "https://alu.atlassian.net/rest/api/2/issue/ALU-1", `{"update":{}}`, true},
+		{mPost, "https://alu.atlassian.net/rest/api/2/issue/ALU-1/transitions", `{"transition":{"id":"31"}}`, true},
+		{mDelete, "https://api.freshbooks.com/timetracking/business/1/time_entries/5", "", true},
+	}
+	for _, tt := range tests {
+		req, err := http.NewRequest(tt.method, tt.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := isWrite(req, []byte(tt.body)); got != tt.want {
+			t.Errorf("%s %s %s: %v, want %v", tt.method, tt.url, tt.body, got, tt.want)
+		}
+	}
+}